@@ -3,6 +3,7 @@
 package archaius
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,14 +11,17 @@ import (
 	filesource "github.com/go-chassis/go-archaius/source/file"
 
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/go-chassis/go-archaius/event"
 	"github.com/go-chassis/go-archaius/pkg/cast"
 	"github.com/go-chassis/go-archaius/source"
 	"github.com/go-chassis/go-archaius/source/cli"
+	configmapsource "github.com/go-chassis/go-archaius/source/configmap"
 	"github.com/go-chassis/go-archaius/source/env"
 	"github.com/go-chassis/go-archaius/source/mem"
+	"github.com/go-chassis/go-archaius/source/secret"
 	"github.com/go-chassis/openlog"
 )
 
@@ -32,30 +36,133 @@ func initFileSource(o *Options) (source.ConfigSource, error) {
 	files := make([]string, 0)
 	// created file source object
 	fs = filesource.NewFileSource()
+	activeOverlays = newOverlays(o)
+	if len(activeOverlays.profiles) > 0 {
+		openlog.Info(fmt.Sprintf("Active profiles: %s", strings.Join(activeOverlays.profiles, ", ")))
+	}
 	// adding all files with file source
 	for _, v := range o.RequiredFiles {
-		if err := fs.AddFile(v, filesource.DefaultFilePriority, o.FileHandler); err != nil {
+		if err := requireMatches(v); err != nil {
+			openlog.Error(fmt.Sprintf("add file source error [%s].", err.Error()))
+			return nil, err
+		}
+		added, err := addFile(v, true, filePriority(o, v), fileOptions(o))
+		if err != nil {
 			openlog.Error(fmt.Sprintf("add file source error [%s].", err.Error()))
 			return nil, err
 		}
-		files = append(files, v)
+		files = append(files, added...)
 	}
 	for _, v := range o.OptionalFiles {
-		_, err := os.Stat(v)
-		if os.IsNotExist(err) {
-			openlog.Info(fmt.Sprintf("[%s] not exist", v))
-			continue
-		}
-		if err := fs.AddFile(v, filesource.DefaultFilePriority, o.FileHandler); err != nil {
+		added, err := addFile(v, false, filePriority(o, v), fileOptions(o))
+		if err != nil {
 			openlog.Info(err.Error())
 			return nil, err
 		}
-		files = append(files, v)
+		files = append(files, added...)
+	}
+	if o.WritableFile != "" {
+		// it is added last with the highest priority, so that changes written to it win
+		opts := append(fileOptions(o), filesource.WithPriority(0), filesource.WithWritable())
+		if err := fs.AddFileWithOptions(o.WritableFile, opts...); err != nil {
+			openlog.Error(fmt.Sprintf("add writable file error [%s].", err.Error()))
+			return nil, err
+		}
+		files = append(files, o.WritableFile)
 	}
 	openlog.Info(fmt.Sprintf("Configuration files: %s", strings.Join(files, ", ")))
 	return fs, nil
 }
 
+// addFile adds file and its profile overlays which exist, file must exist if it is required.
+// it returns the files added
+func addFile(file string, required bool, priority uint32, opts []filesource.Option) ([]string, error) {
+	added := make([]string, 0)
+	for i, f := range activeOverlays.files(file) {
+		if i > 0 || !required {
+			_, err := os.Stat(f)
+			if os.IsNotExist(err) && !isGlob(f) {
+				openlog.Info(fmt.Sprintf("[%s] not exist", f))
+				continue
+			}
+		}
+		fileOpts := append(opts[:len(opts):len(opts)], filesource.WithPriority(activeOverlays.priority(priority, i)))
+		if err := fs.AddFileWithOptions(f, fileOpts...); err != nil {
+			return added, err
+		}
+		added = append(added, f)
+	}
+	return added, nil
+}
+
+func filePriority(o *Options, file string) uint32 {
+	if p, ok := o.FilePriorities[file]; ok {
+		return p
+	}
+	return filesource.DefaultFilePriority
+}
+
+func fileOptions(o *Options) []filesource.Option {
+	opts := []filesource.Option{
+		filesource.WithHandler(o.FileHandler),
+		filesource.WithInclude(o.IncludeFiles...),
+		filesource.WithExclude(o.ExcludeFiles...),
+		filesource.WithPolling(o.FilePollInterval),
+		filesource.WithDebounce(o.FileDebounceWindow),
+	}
+	if o.RecursiveDirs {
+		opts = append(opts, filesource.WithRecursive())
+	}
+	return opts
+}
+
+func isGlob(file string) bool {
+	return strings.ContainsAny(file, "*?[")
+}
+
+// initSecretSource adds directories of secrets in order of path, so that a conflict is resolved the same way every time
+func initSecretSource(o *Options) error {
+	dirs := make([]string, 0, len(o.SecretDirs))
+	for dir := range o.SecretDirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	ss := secret.NewSecretSource()
+	for _, dir := range dirs {
+		if err := ss.AddDir(dir, secret.WithPrefix(o.SecretDirs[dir])); err != nil {
+			openlog.Error(fmt.Sprintf("add secret dir error [%s].", err.Error()))
+			return err
+		}
+	}
+	return manager.AddSource(ss)
+}
+
+func initConfigMapSource(o *Options) error {
+	cms := configmapsource.NewConfigMapSource()
+	for _, dir := range o.ConfigMapDirs {
+		if err := cms.AddFile(dir, configmapsource.DefaultConfigMapPriority, o.ConfigMapHandler); err != nil {
+			openlog.Error(fmt.Sprintf("add config map dir error [%s].", err.Error()))
+			return err
+		}
+	}
+	return manager.AddSource(cms)
+}
+
+// requireMatches checks a required glob matches at least one file
+func requireMatches(file string) error {
+	if !isGlob(file) {
+		return nil
+	}
+	matches, err := filesource.Glob(file)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no file matches [%s]", file)
+	}
+	return nil
+}
+
 // Init create a Archaius config singleton
 func Init(opts ...Option) error {
 	if running {
@@ -68,7 +175,11 @@ func Init(opts ...Option) error {
 		opt(o)
 	}
 
-	manager = source.NewManager()
+	if o.SyncDispatch {
+		manager = source.NewManager(source.WithSyncDispatch())
+	} else {
+		manager = source.NewManager()
+	}
 
 	fs, err := initFileSource(o)
 	if err != nil {
@@ -93,17 +204,34 @@ func Init(opts ...Option) error {
 		}
 	}
 	if o.UseCLISource {
-		cmdSource := cli.NewCommandlineConfigSource()
+		cmdSource, err := cli.NewCommandlineSource(o.CLIOptions...)
+		if err != nil {
+			return err
+		}
 		if err = manager.AddSource(cmdSource); err != nil {
 			return err
 		}
 	}
 	if o.UseENVSource {
-		envSource := env.NewEnvConfigurationSource()
+		envSource := env.NewEnvConfigurationSource(o.ENVOptions...)
 		if err = manager.AddSource(envSource); err != nil {
 			return err
 		}
 	}
+	if len(o.SecretDirs) > 0 {
+		if err = initSecretSource(o); err != nil {
+			return err
+		}
+	}
+	if len(o.ConfigMapDirs) > 0 {
+		if err = initConfigMapSource(o); err != nil {
+			return err
+		}
+	}
+
+	if o.ReloadOnSIGHUP {
+		stopReloadSignal = handleReloadSignal()
+	}
 
 	openlog.Info("archaius init success")
 	running = true
@@ -260,6 +388,12 @@ func RegisterListener(listenerObj event.Listener, key ...string) error {
 	return manager.RegisterListener(listenerObj, key...)
 }
 
+//RegisterListenerWithOptions to Register listener for different key changes with options,
+//for example, event.WithInitialState() delivers current values of matching keys before any update
+func RegisterListenerWithOptions(listenerObj event.Listener, keys []string, opts ...event.RegisterOption) error {
+	return manager.RegisterListenerWithOptions(listenerObj, keys, opts...)
+}
+
 // UnRegisterListener is to remove the listener
 func UnRegisterListener(listenerObj event.Listener, key ...string) error {
 	return manager.UnRegisterListener(listenerObj, key...)
@@ -270,25 +404,88 @@ func RegisterModuleListener(listenerObj event.ModuleListener, prefix ...string)
 	return manager.RegisterModuleListener(listenerObj, prefix...)
 }
 
+//RegisterModuleListenerWithOptions to Register moduleListener for different key(prefix) changes with options
+func RegisterModuleListenerWithOptions(listenerObj event.ModuleListener, prefixes []string,
+	opts ...event.RegisterOption) error {
+	return manager.RegisterModuleListenerWithOptions(listenerObj, prefixes, opts...)
+}
+
 // UnRegisterModuleListener is to remove the moduleListener
 func UnRegisterModuleListener(listenerObj event.ModuleListener, prefix ...string) error {
 	return manager.UnRegisterModuleListener(listenerObj, prefix...)
 }
 
-// AddFile is for to add the configuration files at runtime
+//RegisterModuleValidator to register validator for different key(prefix) changes,
+//a validator can reject a batch of changes before it is applied, so that listeners never receive it
+func RegisterModuleValidator(validator event.ModuleValidator, prefix ...string) error {
+	return manager.RegisterModuleValidator(validator, prefix...)
+}
+
+// UnRegisterModuleValidator is to remove the validator
+func UnRegisterModuleValidator(validator event.ModuleValidator, prefix ...string) error {
+	return manager.UnRegisterModuleValidator(validator, prefix...)
+}
+
+//RegisterErrorListener to register listener for errors of sources,
+//for example, a config file saved with syntax error. the last good configurations of it are still used
+func RegisterErrorListener(listenerObj event.ErrorListener) error {
+	return manager.RegisterErrorListener(listenerObj)
+}
+
+// UnRegisterErrorListener is to remove the error listener
+func UnRegisterErrorListener(listenerObj event.ErrorListener) error {
+	return manager.UnRegisterErrorListener(listenerObj)
+}
+
+// GetSourceStatus returns the status of a config source, like the latest rejected changes and files failing to load
+func GetSourceStatus(sourceName string) (source.Status, bool) {
+	return manager.SourceStatus(sourceName)
+}
+
+// AddFile is for to add the configuration files at runtime,
+// file can be a directory or a glob like "conf/**/*.yaml",
+// files created later in the directory or matching the glob are added automatically.
+// overlays of active profiles are added with file
 func AddFile(file string, opts ...FileOption) error {
 	o := &FileOptions{}
 	for _, f := range opts {
 		f(o)
 	}
-	if err := fs.AddFile(file, filesource.DefaultFilePriority, o.Handler); err != nil {
+	fileOpts := []filesource.Option{
+		filesource.WithHandler(o.Handler),
+		filesource.WithInclude(o.Include...),
+		filesource.WithExclude(o.Exclude...),
+		filesource.WithPolling(o.PollInterval),
+		filesource.WithDebounce(o.DebounceWindow),
+	}
+	if o.Recursive {
+		fileOpts = append(fileOpts, filesource.WithRecursive())
+	}
+	if o.Writable {
+		// writable file has no overlay
+		fileOpts = append(fileOpts, filesource.WithPriority(o.Priority), filesource.WithWritable())
+		if err := fs.AddFileWithOptions(file, fileOpts...); err != nil {
+			return err
+		}
+	} else if _, err := addFile(file, true, o.Priority, fileOpts); err != nil {
 		return err
 	}
 	return manager.Refresh(fs.GetSourceName())
 }
 
+// RemoveFile removes a file, directory or glob added by Init or AddFile, and its overlays of active profiles.
+// it is not watched any more, its keys are deleted, or updated if another file or source still has them
+func RemoveFile(file string) error {
+	for i, f := range activeOverlays.files(file) {
+		if err := fs.RemoveFile(f); err != nil && i == 0 {
+			return err
+		}
+	}
+	return manager.Refresh(fs.GetSourceName())
+}
+
 //Set add the configuration key, value pairs into memory source at runtime
-//it is just affect the local configs
+//it is just affect the local configs, unless a writable file is given by WithWritableFile
 func Set(key string, value interface{}) error {
 	return manager.Set(key, value)
 }
@@ -298,6 +495,23 @@ func Delete(key string) error {
 	return manager.Delete(key)
 }
 
+// Revision returns the revision of the latest configuration change,
+// use it with WaitForRevision to wait until a change is delivered to listeners
+func Revision() uint64 {
+	return manager.Revision()
+}
+
+// WaitForRevision blocks until changes up to rev are delivered to all listeners, or ctx is done
+func WaitForRevision(ctx context.Context, rev uint64) error {
+	return manager.WaitForRevision(ctx, rev)
+}
+
+// Flush applies the changes sources have not noticed yet, like a file written but not reported by watcher,
+// then blocks until every change applied so far is delivered to all listeners, or ctx is done
+func Flush(ctx context.Context) error {
+	return manager.Flush(ctx)
+}
+
 //AddSource add source implementation
 func AddSource(source source.ConfigSource) error {
 	return manager.AddSource(source)
@@ -305,9 +519,17 @@ func AddSource(source source.ConfigSource) error {
 
 //Clean will call config manager CleanUp Method,
 //it deletes all sources which means all of key value is deleted.
-//after you call Clean, you can init archaius again
+//after you call Clean, you can init archaius again, it does nothing if archaius is not initialized
 func Clean() error {
+	if manager == nil {
+		return nil
+	}
+	if stopReloadSignal != nil {
+		stopReloadSignal()
+		stopReloadSignal = nil
+	}
 	manager.Cleanup()
+	activeOverlays = overlays{}
 	running = false
 	return nil
 }
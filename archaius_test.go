@@ -2,15 +2,26 @@ package archaius_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/go-chassis/go-archaius"
 	"github.com/go-chassis/go-archaius/event"
+	"github.com/go-chassis/go-archaius/source"
+	"github.com/go-chassis/go-archaius/source/cli"
+	filesource "github.com/go-chassis/go-archaius/source/file"
+	"github.com/go-chassis/go-archaius/source/env"
+	"github.com/go-chassis/go-archaius/source/mem"
+	"github.com/go-chassis/go-archaius/source/util"
 	"github.com/go-chassis/openlog"
+	"github.com/spf13/cast"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -115,6 +126,90 @@ func TestConfig_RegisterListener(t *testing.T) {
 
 }
 
+type keyListener struct {
+	ch chan *event.Event
+}
+
+func (l *keyListener) Event(e *event.Event) {
+	l.ch <- e
+}
+
+func TestRegisterListenerWithOptions(t *testing.T) {
+	err := archaius.Set("replay.size", 3)
+	assert.NoError(t, err)
+	lis := &keyListener{ch: make(chan *event.Event, 10)}
+	err = archaius.RegisterListenerWithOptions(lis, []string{"replay.*"}, event.WithInitialState())
+	assert.NoError(t, err)
+	defer archaius.UnRegisterListener(lis, "replay.*")
+	err = archaius.Set("replay.size", 4)
+	assert.NoError(t, err)
+
+	e := <-lis.ch
+	assert.Equal(t, event.Create, e.EventType)
+	assert.Equal(t, 3, e.Value)
+	assert.Equal(t, "MemorySource", e.EventSource)
+	e = <-lis.ch
+	assert.Equal(t, event.Update, e.EventType)
+	assert.Equal(t, 4, e.Value)
+	archaius.Delete("replay.size")
+}
+
+type poolValidator struct{}
+
+func (poolValidator) Validate(events []*event.Event) error {
+	for _, e := range events {
+		if e.EventType != event.Delete && cast.ToInt(e.Value) < 0 {
+			return fmt.Errorf("%s can not be negative", e.Key)
+		}
+	}
+	return nil
+}
+
+func TestRegisterModuleValidator(t *testing.T) {
+	v := poolValidator{}
+	err := archaius.RegisterModuleValidator(v, "pool")
+	assert.NoError(t, err)
+	defer archaius.UnRegisterModuleValidator(v, "pool")
+
+	err = archaius.Set("pool.size", 10)
+	assert.NoError(t, err)
+	err = archaius.Set("pool.size", -1)
+	assert.Error(t, err)
+	assert.Equal(t, 10, archaius.Get("pool.size"))
+
+	status, ok := archaius.GetSourceStatus("MemorySource")
+	assert.True(t, ok)
+	assert.Equal(t, 1, status.RejectedCount)
+	if assert.NotNil(t, status.LastRejection) {
+		assert.Equal(t, "pool.size", status.LastRejection.Events[0].Key)
+	}
+	archaius.Delete("pool.size")
+}
+
+// readingValidator records the value of key it reads while validating
+type readingValidator struct {
+	key  string
+	read []interface{}
+}
+
+func (v *readingValidator) Validate(events []*event.Event) error {
+	v.read = append(v.read, archaius.Get(v.key))
+	return poolValidator{}.Validate(events)
+}
+
+func TestValidatorReadsAcceptedValues(t *testing.T) {
+	v := &readingValidator{key: "pool.size"}
+	assert.NoError(t, archaius.RegisterModuleValidator(v, "pool"))
+	defer archaius.UnRegisterModuleValidator(v, "pool")
+
+	assert.NoError(t, archaius.Set("pool.size", 10))
+	assert.Error(t, archaius.Set("pool.size", -1))
+	// the rejected value is never visible, even while it is validated
+	assert.Equal(t, []interface{}{nil, 10}, v.read)
+	assert.Equal(t, 10, archaius.Get("pool.size"))
+	archaius.Delete("pool.size")
+}
+
 func TestUnmarshalConfig(t *testing.T) {
 	b := []byte(`
 key: peter
@@ -323,3 +418,515 @@ ssl:
 	assert.Equal(t, "private.pem", sslConfig.Ssl["rest.Provider.keyFile"])
 	assert.Equal(t, "PwdFile.yaml", sslConfig.Ssl["rest.Provider.certPwdFile"])
 }
+func TestSyncDispatch(t *testing.T) {
+	archaius.Clean()
+	d, _ := os.Getwd()
+	syncFile := filepath.Join(d, "sync.yaml")
+	err := ioutil.WriteFile(syncFile, []byte("sync:\n  timeout: 1\n"), 0600)
+	assert.NoError(t, err)
+	defer os.Remove(syncFile)
+	err = archaius.Init(archaius.WithSyncDispatch(),
+		archaius.WithRequiredFiles([]string{syncFile}),
+		archaius.WithMemorySource())
+	assert.NoError(t, err)
+	defer archaius.Clean()
+
+	lis := &keyListener{ch: make(chan *event.Event, 10)}
+	err = archaius.RegisterListener(lis, "sync.*")
+	assert.NoError(t, err)
+	defer archaius.UnRegisterListener(lis, "sync.*")
+	t.Run("listener is called before Set returns", func(t *testing.T) {
+		err = archaius.Set("sync.size", 1)
+		assert.NoError(t, err)
+		if assert.Len(t, lis.ch, 1) {
+			e := <-lis.ch
+			assert.Equal(t, "sync.size", e.Key)
+		}
+	})
+	t.Run("listener is called before Flush returns", func(t *testing.T) {
+		err = ioutil.WriteFile(syncFile, []byte("sync:\n  timeout: 2\n"), 0600)
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		err = archaius.Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, archaius.GetInt("sync.timeout", 0))
+		// the watcher may report the same write later, it generates no event
+		if assert.Len(t, lis.ch, 1) {
+			e := <-lis.ch
+			assert.Equal(t, "sync.timeout", e.Key)
+			assert.Equal(t, 2, e.Value)
+		}
+		rev := archaius.Revision()
+		assert.NoError(t, archaius.WaitForRevision(ctx, rev))
+	})
+}
+
+func TestFilePriorities(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "priorities")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "base.yaml")
+	override := filepath.Join(dir, "override.yaml")
+	extra := filepath.Join(dir, "extra.yaml")
+	assert.NoError(t, ioutil.WriteFile(base, []byte("timeout: 1\nretry: 1\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(override, []byte("timeout: 2\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(extra, []byte("retry: 3\n"), 0600))
+	err = archaius.Init(archaius.WithRequiredFiles([]string{base, override}))
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	assert.Equal(t, 2, archaius.Get("timeout"))
+
+	err = archaius.AddFile(extra, archaius.WithFilePriority(1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, archaius.Get("retry"))
+
+	c := archaius.GetConfigsWithSourceNames()
+	assert.Equal(t, override, c["timeout"].(map[string]interface{})["location"])
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, archaius.WriteTo(buf))
+	assert.Contains(t, buf.String(), "timeout: 2 # from "+override)
+}
+
+type errorListener struct {
+	ch chan *event.SourceError
+}
+
+func (l *errorListener) OnError(e *event.SourceError) {
+	l.ch <- e
+}
+
+func TestFileErrors(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "errors")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	app := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, ioutil.WriteFile(app, []byte("timeout: 1\n"), 0600))
+	err = archaius.Init(archaius.WithSyncDispatch(), archaius.WithRequiredFiles([]string{app}))
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	lis := &errorListener{ch: make(chan *event.SourceError, 10)}
+	assert.NoError(t, archaius.RegisterErrorListener(lis))
+	defer archaius.UnRegisterErrorListener(lis)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	t.Run("bad edit keeps last good configurations", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(app, []byte("timeout: 2\nretry: [1\n"), 0600))
+		assert.Error(t, archaius.Flush(ctx))
+		assert.Equal(t, 1, archaius.Get("timeout"))
+		if assert.Len(t, lis.ch, 1) {
+			e := <-lis.ch
+			assert.Equal(t, app, e.Location)
+			assert.Error(t, e.Err)
+		}
+		s, ok := archaius.GetSourceStatus(filesource.FileConfigSourceConst)
+		assert.True(t, ok)
+		if assert.Len(t, s.Errors, 1) {
+			assert.Equal(t, app, s.Errors[0].Location)
+			assert.Equal(t, 2, s.Errors[0].Line)
+			assert.False(t, s.Errors[0].Time.IsZero())
+		}
+	})
+	t.Run("same error is reported once", func(t *testing.T) {
+		assert.Error(t, archaius.Flush(ctx))
+		assert.Len(t, lis.ch, 0)
+	})
+	t.Run("good edit resolves error", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(app, []byte("timeout: 3\n"), 0600))
+		assert.NoError(t, archaius.Flush(ctx))
+		assert.Equal(t, 3, archaius.Get("timeout"))
+		if assert.Len(t, lis.ch, 1) {
+			e := <-lis.ch
+			assert.NoError(t, e.Err)
+		}
+		s, _ := archaius.GetSourceStatus(filesource.FileConfigSourceConst)
+		assert.Empty(t, s.Errors)
+	})
+}
+
+func TestProfiles(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "profiles")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		f := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(f, []byte(content), 0600))
+		return f
+	}
+	app := write("app.yaml", "a: base\nb: base\nc: base\nd: base\n")
+	write("app-prod.yaml", "b: prod\nc: prod\nd: prod\n")
+	write("app-eu.yaml", "c: eu\nd: eu\n")
+	write("app.local.yaml", "d: local\n")
+	common := write("common.yaml", "a: common\ne: common\n")
+	write("common-prod.yaml", "a: common-prod\ne: common-prod\n")
+
+	t.Run("overlays have increasing priority", func(t *testing.T) {
+		// common.yaml has higher priority than app.yaml and its overlays
+		err = archaius.Init(archaius.WithRequiredFiles([]string{common, app}),
+			archaius.WithFilePriorities(map[string]uint32{app: 1}),
+			archaius.WithProfiles("prod", "eu"), archaius.WithLocalOverlay())
+		assert.NoError(t, err)
+		defer archaius.Clean()
+		assert.Equal(t, []string{"prod", "eu"}, archaius.Profiles())
+		assert.Equal(t, "common-prod", archaius.Get("a"))
+		assert.Equal(t, "prod", archaius.Get("b"))
+		assert.Equal(t, "eu", archaius.Get("c"))
+		assert.Equal(t, "local", archaius.Get("d"))
+		assert.Equal(t, "common-prod", archaius.Get("e"))
+	})
+	t.Run("env wins over option", func(t *testing.T) {
+		os.Setenv(archaius.ProfilesEnv, "eu")
+		defer os.Unsetenv(archaius.ProfilesEnv)
+		err = archaius.Init(archaius.WithOptionalFiles([]string{app}), archaius.WithProfiles("prod"))
+		assert.NoError(t, err)
+		defer archaius.Clean()
+		assert.Equal(t, []string{"eu"}, archaius.Profiles())
+		assert.Equal(t, "base", archaius.Get("b"))
+		assert.Equal(t, "eu", archaius.Get("d"))
+	})
+	t.Run("command line wins over env", func(t *testing.T) {
+		os.Setenv(archaius.ProfilesEnv, "eu")
+		defer os.Unsetenv(archaius.ProfilesEnv)
+		args := []string{"--archaius.profiles.active", "prod", "serve"}
+		err = archaius.Init(archaius.WithOptionalFiles([]string{app}),
+			archaius.WithCommandLineSource(cli.WithArgs(args)))
+		assert.NoError(t, err)
+		defer archaius.Clean()
+		assert.Equal(t, []string{"prod"}, archaius.Profiles())
+		assert.Equal(t, "prod", archaius.Get("d"))
+	})
+	t.Run("runtime file has overlays", func(t *testing.T) {
+		err = archaius.Init(archaius.WithProfiles("prod"))
+		assert.NoError(t, err)
+		defer archaius.Clean()
+		assert.NoError(t, archaius.AddFile(app))
+		assert.Equal(t, "prod", archaius.Get("d"))
+	})
+}
+
+func TestLargeFilePriority(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "priority")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	low := filepath.Join(dir, "low.yaml")
+	assert.NoError(t, ioutil.WriteFile(low, []byte("a: low\n"), 0600))
+	high := filepath.Join(dir, "high.yaml")
+	assert.NoError(t, ioutil.WriteFile(high, []byte("a: high\n"), 0600))
+	err = archaius.Init(archaius.WithRequiredFiles([]string{low, high}),
+		archaius.WithFilePriorities(map[string]uint32{low: 1 << 31, high: 1}), archaius.WithProfiles("prod"))
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	assert.Equal(t, "high", archaius.Get("a"))
+}
+
+func TestWritableFile(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "writable")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	app := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, ioutil.WriteFile(app, []byte("limit:\n  qps: 100\n"), 0600))
+	runtime := filepath.Join(dir, "runtime.yaml")
+
+	err = archaius.Init(archaius.WithRequiredFiles([]string{app}), archaius.WithWritableFile(runtime))
+	assert.NoError(t, err)
+	assert.Equal(t, 100, archaius.Get("limit.qps"))
+	assert.NoError(t, archaius.Set("limit.qps", 200))
+	assert.Equal(t, 200, archaius.Get("limit.qps"))
+	b, err := ioutil.ReadFile(runtime)
+	assert.NoError(t, err)
+	assert.Equal(t, "limit:\n  qps: 200\n", string(b))
+	archaius.Clean()
+
+	err = archaius.Init(archaius.WithRequiredFiles([]string{app}), archaius.WithWritableFile(runtime))
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	assert.Equal(t, 200, archaius.Get("limit.qps"))
+	assert.NoError(t, archaius.Delete("limit.qps"))
+	assert.Equal(t, 100, archaius.Get("limit.qps"))
+}
+
+func TestRemoveFile(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "remove")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	plugin := filepath.Join(dir, "plugin.yaml")
+	assert.NoError(t, ioutil.WriteFile(plugin, []byte("plugin:\n  timeout: 2\n  name: p\n"), 0600))
+	err = archaius.Init(archaius.WithSyncDispatch())
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	assert.NoError(t, archaius.AddFile(plugin))
+	// a source with lower priority than file source
+	fallback := mem.NewMemoryConfigurationSource()
+	fallback.SetPriority(5)
+	assert.NoError(t, archaius.AddSource(fallback))
+	assert.NoError(t, archaius.Set("plugin.timeout", 1))
+	assert.Equal(t, 2, archaius.Get("plugin.timeout"))
+
+	lis := &keyListener{ch: make(chan *event.Event, 10)}
+	assert.NoError(t, archaius.RegisterListener(lis, "plugin.*"))
+	defer archaius.UnRegisterListener(lis, "plugin.*")
+	// validators can't reject the removal
+	assert.NoError(t, archaius.RegisterModuleValidator(rejectValidator{}, "plugin"))
+	defer archaius.UnRegisterModuleValidator(rejectValidator{}, "plugin")
+	assert.NoError(t, archaius.RemoveFile(plugin))
+	assert.Equal(t, 1, archaius.Get("plugin.timeout"))
+	assert.False(t, archaius.Exist("plugin.name"))
+	events := make(map[string]*event.Event)
+	for len(lis.ch) > 0 {
+		e := <-lis.ch
+		events[e.Key] = e
+	}
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, event.Update, events["plugin.timeout"].EventType)
+		assert.Equal(t, 1, events["plugin.timeout"].Value)
+		assert.Equal(t, event.Delete, events["plugin.name"].EventType)
+	}
+}
+
+// rejectValidator rejects all changes
+type rejectValidator struct{}
+
+func (rejectValidator) Validate(events []*event.Event) error {
+	return fmt.Errorf("%d changes are not allowed", len(events))
+}
+
+// unwatchedSource never watches the source it wraps
+type unwatchedSource struct {
+	source.ConfigSource
+}
+
+func (unwatchedSource) Watch(source.EventHandler) error {
+	return nil
+}
+
+func (unwatchedSource) GetSourceName() string {
+	return "UnwatchedSource"
+}
+
+func TestRemoveFileBeforeWatched(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "remove")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	plugin := filepath.Join(dir, "plugin.yaml")
+	assert.NoError(t, ioutil.WriteFile(plugin, []byte("plugin:\n  timeout: 2\n"), 0600))
+	err = archaius.Init(archaius.WithSyncDispatch())
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	fSource := filesource.NewFileSource()
+	assert.NoError(t, fSource.AddFile(plugin, 0, nil))
+	assert.NoError(t, archaius.AddSource(unwatchedSource{fSource}))
+	assert.Equal(t, 2, archaius.Get("plugin.timeout"))
+	assert.NoError(t, archaius.RegisterModuleValidator(rejectValidator{}, "plugin"))
+	defer archaius.UnRegisterModuleValidator(rejectValidator{}, "plugin")
+
+	// the source removes the file without events, reloading prunes its keys, validators can't keep them
+	assert.NoError(t, fSource.RemoveFile(plugin))
+	assert.NoError(t, archaius.ReloadAll(context.Background()))
+	assert.False(t, archaius.Exist("plugin.timeout"))
+	assert.NotContains(t, archaius.GetConfigsWithSourceNames(), "plugin.timeout")
+}
+
+func TestReloadAllNewKeys(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	timeout := filepath.Join(dir, "timeout.yaml")
+	assert.NoError(t, ioutil.WriteFile(timeout, []byte("reload:\n  timeout: 1\n"), 0600))
+	retry := filepath.Join(dir, "retry.yaml")
+	assert.NoError(t, ioutil.WriteFile(retry, []byte("reload:\n  retry: 3\n"), 0600))
+	err = archaius.Init(archaius.WithSyncDispatch())
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	fSource := filesource.NewFileSource()
+	assert.NoError(t, archaius.AddSource(unwatchedSource{fSource}))
+	lis := &keyListener{ch: make(chan *event.Event, 10)}
+	assert.NoError(t, archaius.RegisterListener(lis, "reload.*"))
+	defer archaius.UnRegisterListener(lis, "reload.*")
+
+	// the wrapped source is not Reloader, its new keys are applied as events
+	assert.NoError(t, fSource.AddFile(timeout, 0, nil))
+	assert.NoError(t, archaius.ReloadAll(context.Background()))
+	assert.Equal(t, 1, archaius.Get("reload.timeout"))
+	if assert.Len(t, lis.ch, 1) {
+		e := <-lis.ch
+		assert.Equal(t, event.Create, e.EventType)
+		assert.Equal(t, 1, e.Value)
+	}
+
+	assert.NoError(t, archaius.RegisterModuleValidator(rejectValidator{}, "reload"))
+	defer archaius.UnRegisterModuleValidator(rejectValidator{}, "reload")
+	assert.NoError(t, fSource.AddFile(retry, 0, nil))
+	assert.Error(t, archaius.ReloadAll(context.Background()))
+	assert.False(t, archaius.Exist("reload.retry"))
+	assert.Len(t, lis.ch, 0)
+}
+
+// nopHandler ignores events
+type nopHandler struct{}
+
+func (nopHandler) OnEvent(*event.Event) {}
+
+func (nopHandler) OnModuleEvent([]*event.Event) {}
+
+func TestReloadAllChangedValues(t *testing.T) {
+	archaius.Clean()
+	err := archaius.Init(archaius.WithSyncDispatch())
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	// changes of the wrapped source are not reported to archaius
+	memSource := mem.NewMemoryConfigurationSource()
+	go memSource.Watch(nopHandler{})
+	assert.NoError(t, memSource.Set("reload.timeout", 1))
+	assert.NoError(t, archaius.AddSource(unwatchedSource{memSource}))
+	lis := &keyListener{ch: make(chan *event.Event, 10)}
+	assert.NoError(t, archaius.RegisterListener(lis, "reload.*"))
+	defer archaius.UnRegisterListener(lis, "reload.*")
+
+	assert.NoError(t, archaius.ReloadAll(context.Background()))
+	assert.Len(t, lis.ch, 0)
+
+	assert.NoError(t, memSource.Set("reload.timeout", 2))
+	assert.NoError(t, archaius.ReloadAll(context.Background()))
+	if assert.Len(t, lis.ch, 1) {
+		e := <-lis.ch
+		assert.Equal(t, event.Update, e.EventType)
+		assert.Equal(t, 2, e.Value)
+	}
+	assert.NoError(t, archaius.ReloadAll(context.Background()))
+	assert.Len(t, lis.ch, 0)
+
+	assert.NoError(t, memSource.Delete("reload.timeout"))
+	assert.NoError(t, archaius.ReloadAll(context.Background()))
+	if assert.Len(t, lis.ch, 1) {
+		assert.Equal(t, event.Delete, (<-lis.ch).EventType)
+	}
+	assert.False(t, archaius.Exist("reload.timeout"))
+}
+
+func TestIndexedKeys(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "indexed")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	app := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, ioutil.WriteFile(app, []byte(`
+servers:
+  - host: a
+    port: 1
+  - host: b
+    port: 2
+`), 0600))
+	err = archaius.Init(archaius.WithRequiredFiles([]string{app}), archaius.WithMemorySource(),
+		archaius.WithDefaultFileHandler(util.Convert2JavaPropsWithIndexedKeys))
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	assert.Equal(t, 2, archaius.Get("servers[1].port"))
+	assert.NoError(t, archaius.Set("servers[1].port", 3))
+
+	type server struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	}
+	c := &struct {
+		Servers []server `yaml:"servers"`
+	}{}
+	assert.NoError(t, archaius.UnmarshalConfig(c))
+	assert.Equal(t, []server{{Host: "a", Port: 1}, {Host: "b", Port: 3}}, c.Servers)
+}
+
+func TestSecretDir(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "db.password"), []byte("s3cret\n"), 0600))
+	err = archaius.Init(archaius.WithSecretDir(dir, "secret."))
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	assert.Equal(t, "s3cret", archaius.GetString("secret.db.password", ""))
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, archaius.WriteTo(buf))
+	assert.Contains(t, buf.String(), "secret.db.password: '******'")
+	assert.NotContains(t, buf.String(), "s3cret")
+}
+
+func TestConfigMapSource(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "configmap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..v1"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "..v1", "app.yaml"), []byte("app:\n  name: demo\n"), 0600))
+	assert.NoError(t, os.Symlink("..v1", filepath.Join(dir, "..data")))
+	assert.NoError(t, os.Symlink(filepath.Join("..data", "app.yaml"), filepath.Join(dir, "app.yaml")))
+	err = archaius.Init(archaius.WithConfigMapSource([]string{dir}, nil))
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	assert.Equal(t, "demo", archaius.GetString("app.name", ""))
+}
+
+func TestReloadAll(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("app:\n  timeout: 1\n"), 0600))
+	os.Setenv("RELOADTEST_LEVEL", "info")
+	defer os.Unsetenv("RELOADTEST_LEVEL")
+	err = archaius.Init(archaius.WithRequiredFiles([]string{file}),
+		archaius.WithENVSource(env.WithPrefix("RELOADTEST_"), env.WithLowercase()),
+		archaius.WithReloadOnSIGHUP())
+	assert.NoError(t, err)
+	defer archaius.Clean()
+	assert.Equal(t, "info", archaius.GetString("level", ""))
+
+	os.Setenv("RELOADTEST_LEVEL", "debug")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("app:\n  timeout: 2\n"), 0600))
+	assert.NoError(t, archaius.ReloadAll(context.Background()))
+	assert.Equal(t, "debug", archaius.GetString("level", ""))
+	assert.Equal(t, 2, archaius.GetInt("app.timeout", 0))
+
+	t.Run("SIGHUP", func(t *testing.T) {
+		os.Setenv("RELOADTEST_LEVEL", "warn")
+		p, err := os.FindProcess(os.Getpid())
+		assert.NoError(t, err)
+		if err := p.Signal(syscall.SIGHUP); err != nil {
+			t.Skip("SIGHUP is not supported: " + err.Error())
+		}
+		assert.Eventually(t, func() bool {
+			return archaius.GetString("level", "") == "warn"
+		}, 3*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestRequiredEnvPlaceholder(t *testing.T) {
+	archaius.Clean()
+	dir, err := ioutil.TempDir("", "placeholder")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "db.yaml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("db:\n  password: ${PLACEHOLDER_DB_PASS:?must be set}\n"), 0600))
+	assert.NoError(t, archaius.Init(archaius.WithMemorySource()))
+	defer archaius.Clean()
+
+	os.Unsetenv("PLACEHOLDER_DB_PASS")
+	err = archaius.AddFile(file)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "PLACEHOLDER_DB_PASS: must be set")
+	}
+
+	os.Setenv("PLACEHOLDER_DB_PASS", "s3cret")
+	defer os.Unsetenv("PLACEHOLDER_DB_PASS")
+	assert.NoError(t, archaius.AddFile(file))
+	assert.Equal(t, "s3cret", archaius.GetString("db.password", ""))
+}
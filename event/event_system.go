@@ -22,9 +22,13 @@
 package event
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/go-chassis/openlog"
 )
@@ -42,6 +46,10 @@ const (
 	InvalidAction = "INVALID-ACTION"
 )
 
+// wildcardPart matches any single part of a key
+const wildcardPart = "*"
+
+// PrefixIndex is a tree of key prefixes split by ".", a prefix like "servicecomb.*.circuitBreaker" is supported
 type PrefixIndex struct {
 	Prefix string
 	NextParts map[string]*PrefixIndex
@@ -101,20 +109,65 @@ func (pre *PrefixIndex) RemovePrefix(prefix string) {
 	}
 }
 
+// FindPrefix returns the shortest registered prefix of key,
+// a "*" part in prefix matches any single part of key, exact parts are preferred
 func (pre *PrefixIndex) FindPrefix(key string) string {
 	parts := strings.Split(key, ".")
-	cur := pre
-	for _, part := range parts {
-		if cur.Prefix != "" {
-			return cur.Prefix
-		}
-		next, ok := cur.NextParts[part]
+	prefix, _ := pre.findPrefix(parts, 0)
+	return prefix
+}
+
+func (pre *PrefixIndex) findPrefix(parts []string, depth int) (string, int) {
+	if pre.Prefix != "" {
+		return pre.Prefix, depth
+	}
+	if len(parts) == 0 {
+		return "", 0
+	}
+	best, bestDepth := "", 0
+	candidates := []string{parts[0]}
+	if parts[0] != wildcardPart {
+		candidates = append(candidates, wildcardPart)
+	}
+	for _, part := range candidates {
+		next, ok := pre.NextParts[part]
 		if !ok {
-			return ""
+			continue
+		}
+		prefix, d := next.findPrefix(parts[1:], depth+1)
+		if prefix != "" && (best == "" || d < bestDepth) {
+			best, bestDepth = prefix, d
 		}
-		cur = next
 	}
-	return cur.Prefix
+	return best, bestDepth
+}
+
+// FindAllPrefixes returns all registered prefixes of key, from the shortest to the longest
+func (pre *PrefixIndex) FindAllPrefixes(key string) []string {
+	prefixes := pre.findAllPrefixes(strings.Split(key, "."), make([]string, 0))
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return strings.Count(prefixes[i], ".") < strings.Count(prefixes[j], ".")
+	})
+	return prefixes
+}
+
+func (pre *PrefixIndex) findAllPrefixes(parts []string, prefixes []string) []string {
+	if pre.Prefix != "" {
+		prefixes = append(prefixes, pre.Prefix)
+	}
+	if len(parts) == 0 {
+		return prefixes
+	}
+	candidates := []string{parts[0]}
+	if parts[0] != wildcardPart {
+		candidates = append(candidates, wildcardPart)
+	}
+	for _, part := range candidates {
+		if next, ok := pre.NextParts[part]; ok {
+			prefixes = next.findAllPrefixes(parts[1:], prefixes)
+		}
+	}
+	return prefixes
 }
 
 // Event generated when any config changes
@@ -136,47 +189,121 @@ type ModuleListener interface {
 	Event(event []*Event)
 }
 
+// ModuleValidator checks a batch of events before it is applied.
+// if Validate returns an error, the whole batch is rejected and no listener receives it.
+// validators are called synchronously, they must not change configurations
+type ModuleValidator interface {
+	Validate(events []*Event) error
+}
+
+// ValidationError is returned when a ModuleValidator rejects a batch of events
+type ValidationError struct {
+	Prefix string
+	Events []*Event
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("events of module %s rejected: %s", e.Prefix, e.Err)
+}
+
+// Unwrap returns the error given by validator
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
 //Dispatcher is the observer
 type Dispatcher struct {
-	listeners       map[string][]Listener
-	moduleListeners map[string][]ModuleListener
+	mu                sync.RWMutex
+	listeners         map[string][]*listenerEntry
+	moduleListeners   map[string][]*moduleListenerEntry
 	modulePrefixIndex PrefixIndex
+	// each listener has its own queue, so that it receives events in order
+	subscribers map[interface{}]*subscriber
+	stateLoader StateLoader
+	revisions   *revisions
+	// errorListeners receive errors of sources
+	errorListeners []ErrorListener
+
+	// with sync delivery, queues are drained by Drain instead of goroutines
+	syncDelivery bool
+	dirtyMux     sync.Mutex
+	dirty        []*subscriber
+
+	validatorMux         sync.RWMutex
+	validators           map[string][]ModuleValidator
+	validatorPrefixIndex PrefixIndex
+}
+
+type listenerEntry struct {
+	listener Listener
+	opts     RegisterOptions
+}
+
+type moduleListenerEntry struct {
+	listener ModuleListener
+	opts     RegisterOptions
 }
 
 // NewDispatcher is a new Dispatcher for listeners
-func NewDispatcher() *Dispatcher {
+func NewDispatcher(opts ...DispatcherOption) *Dispatcher {
 	dis := new(Dispatcher)
-	dis.listeners = make(map[string][]Listener)
-	dis.moduleListeners = make(map[string][]ModuleListener)
+	dis.listeners = make(map[string][]*listenerEntry)
+	dis.moduleListeners = make(map[string][]*moduleListenerEntry)
+	dis.subscribers = make(map[interface{}]*subscriber)
+	dis.revisions = newRevisions()
+	dis.validators = make(map[string][]ModuleValidator)
+	for _, opt := range opts {
+		opt(dis)
+	}
 	return dis
 }
 
 // RegisterListener registers listener for particular configuration
 func (dis *Dispatcher) RegisterListener(listenerObj Listener, keys ...string) error {
+	return dis.RegisterListenerWithOptions(listenerObj, keys)
+}
+
+// RegisterListenerWithOptions registers listener for particular configuration with options
+func (dis *Dispatcher) RegisterListenerWithOptions(listenerObj Listener, keys []string, opts ...RegisterOption) error {
 	if listenerObj == nil {
 		err := ErrNilListener
 		openlog.Error("nil listener supplied:" + err.Error())
 		return ErrNilListener
 	}
+	o := RegisterOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
 
+	dis.mu.Lock()
+	defer dis.mu.Unlock()
+	newKeys := make([]string, 0, len(keys))
 	for _, key := range keys {
-		listenerList, ok := dis.listeners[key]
-		if !ok {
-			listenerList = make([]Listener, 0)
-		}
+		entries := dis.listeners[key]
 
 		// for duplicate registration
-		for _, listener := range listenerList {
-			if listener == listenerObj {
-				return nil
+		duplicated := false
+		for _, entry := range entries {
+			if entry.listener == listenerObj {
+				duplicated = true
+				break
 			}
 		}
+		if duplicated {
+			continue
+		}
 
-		// append new listener
-		listenerList = append(listenerList, listenerObj)
+		// append new listener and assign latest listener list
+		dis.listeners[key] = append(entries, &listenerEntry{listener: listenerObj, opts: o})
+		dis.subscribe(listenerObj)
+		newKeys = append(newKeys, key)
+	}
 
-		// assign latest listener list
-		dis.listeners[key] = listenerList
+	if o.InitialState && len(newKeys) > 0 {
+		rev := dis.revisions.begin()
+		defer dis.revisions.done(rev)
+		dis.replayState(listenerObj, newKeys, &o, rev)
 	}
 	return nil
 }
@@ -187,23 +314,26 @@ func (dis *Dispatcher) UnRegisterListener(listenerObj Listener, keys ...string)
 		return ErrNilListener
 	}
 
+	dis.mu.Lock()
+	defer dis.mu.Unlock()
 	for _, key := range keys {
-		listenerList, ok := dis.listeners[key]
+		entries, ok := dis.listeners[key]
 		if !ok {
 			continue
 		}
 
-		newListenerList := make([]Listener, 0)
+		newEntries := make([]*listenerEntry, 0)
 		// remove listener
-		for _, listener := range listenerList {
-			if listener == listenerObj {
+		for _, entry := range entries {
+			if entry.listener == listenerObj {
+				dis.unsubscribe(listenerObj)
 				continue
 			}
-			newListenerList = append(newListenerList, listener)
+			newEntries = append(newEntries, entry)
 		}
 
 		// assign latest listener list
-		dis.listeners[key] = newListenerList
+		dis.listeners[key] = newEntries
 	}
 	return nil
 }
@@ -214,17 +344,28 @@ func (dis *Dispatcher) DispatchEvent(event *Event) error {
 		return errors.New("empty event provided")
 	}
 
-	for regKey, listeners := range dis.listeners {
+	rev := dis.revisions.begin()
+	defer dis.revisions.done(rev)
+	dis.mu.RLock()
+	defer dis.mu.RUnlock()
+	// a listener matching the event by several keys only receives it once
+	delivered := make(map[Listener]bool)
+	for regKey, entries := range dis.listeners {
 		matched, err := regexp.MatchString(regKey, event.Key)
 		if err != nil {
 			openlog.Error("regular expression for key " + regKey + " failed:" + err.Error())
 			continue
 		}
-		if matched {
-			for _, listener := range listeners {
-				openlog.Info("event generated for " + regKey)
-				go listener.Event(event)
+		if !matched {
+			continue
+		}
+		for _, entry := range entries {
+			if delivered[entry.listener] || !entry.opts.accept(event) {
+				continue
 			}
+			delivered[entry.listener] = true
+			openlog.Info("event generated for " + regKey)
+			dis.deliver(entry.listener, event, rev)
 		}
 	}
 
@@ -233,31 +374,53 @@ func (dis *Dispatcher) DispatchEvent(event *Event) error {
 
 // RegisterModuleListener registers moduleListener for particular configuration
 func (dis *Dispatcher) RegisterModuleListener(listenerObj ModuleListener, modulePrefixes ...string) error {
+	return dis.RegisterModuleListenerWithOptions(listenerObj, modulePrefixes)
+}
+
+// RegisterModuleListenerWithOptions registers moduleListener for particular configuration with options
+func (dis *Dispatcher) RegisterModuleListenerWithOptions(listenerObj ModuleListener, modulePrefixes []string,
+	opts ...RegisterOption) error {
 	if listenerObj == nil {
 		err := ErrNilListener
 		openlog.Error("nil moduleListener supplied:" + err.Error())
 		return ErrNilListener
 	}
+	o := RegisterOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
 
+	dis.mu.Lock()
+	defer dis.mu.Unlock()
+	newPrefixes := make([]string, 0, len(modulePrefixes))
 	for _, prefix := range modulePrefixes {
-		moduleListeners, ok := dis.moduleListeners[prefix]
+		entries, ok := dis.moduleListeners[prefix]
 		if !ok {
-			moduleListeners = make([]ModuleListener, 0)
 			dis.modulePrefixIndex.AddPrefix(prefix)
 		}
 
 		// for duplicate registration
-		for _, listener := range moduleListeners {
-			if listener == listenerObj {
-				return nil
+		duplicated := false
+		for _, entry := range entries {
+			if entry.listener == listenerObj {
+				duplicated = true
+				break
 			}
 		}
+		if duplicated {
+			continue
+		}
 
-		// append new moduleListener
-		moduleListeners = append(moduleListeners, listenerObj)
+		// append new moduleListener and assign latest moduleListener list
+		dis.moduleListeners[prefix] = append(entries, &moduleListenerEntry{listener: listenerObj, opts: o})
+		dis.subscribe(listenerObj)
+		newPrefixes = append(newPrefixes, prefix)
+	}
 
-		// assign latest moduleListener list
-		dis.moduleListeners[prefix] = moduleListeners
+	if o.InitialState && len(newPrefixes) > 0 {
+		rev := dis.revisions.begin()
+		defer dis.revisions.done(rev)
+		dis.replayModuleState(listenerObj, newPrefixes, &o, rev)
 	}
 	return nil
 }
@@ -268,24 +431,28 @@ func (dis *Dispatcher) UnRegisterModuleListener(listenerObj ModuleListener, modu
 		return ErrNilListener
 	}
 
+	dis.mu.Lock()
+	defer dis.mu.Unlock()
 	for _, prefix := range modulePrefixes {
-		listenerList, ok := dis.moduleListeners[prefix]
+		entries, ok := dis.moduleListeners[prefix]
 		if !ok {
 			continue
 		}
 
-		newListenerList := make([]ModuleListener, 0)
+		newEntries := make([]*moduleListenerEntry, 0)
 		// remove moduleListener
-		for _, listener := range listenerList {
-			if listener == listenerObj {
+		for _, entry := range entries {
+			if entry.listener == listenerObj {
+				dis.unsubscribe(listenerObj)
 				continue
 			}
-			newListenerList = append(newListenerList, listener)
+			newEntries = append(newEntries, entry)
 		}
 
 		// assign latest moduleListener list
-		dis.moduleListeners[prefix] = newListenerList
-		if len(newListenerList) == 0 {
+		dis.moduleListeners[prefix] = newEntries
+		if len(newEntries) == 0 {
+			delete(dis.moduleListeners, prefix)
 			dis.modulePrefixIndex.RemovePrefix(prefix)
 		}
 	}
@@ -298,29 +465,237 @@ func (dis *Dispatcher) DispatchModuleEvent(events []*Event) error {
 		return errors.New("empty events provided")
 	}
 
+	rev := dis.revisions.begin()
+	defer dis.revisions.done(rev)
+	dis.mu.RLock()
+	defer dis.mu.RUnlock()
 	// 1. According to the key in the event, events with the same prefix are placed in the same slice
 	eventsList := dis.parseEvents(events)
 
 	// 2. Events with the same prefix will only be callback once.
 	for key, events := range eventsList {
-		if listeners, ok := dis.moduleListeners[key]; ok {
-			for _, listener := range listeners {
-				openlog.Info("events generated for " + key)
-				go listener.Event(events)
+		for _, entry := range dis.moduleListeners[key] {
+			accepted := entry.opts.filter(events)
+			if len(accepted) == 0 {
+				continue
+			}
+			openlog.Info("events generated for " + key)
+			dis.deliverModule(entry.listener, accepted, rev)
+		}
+	}
+
+	return nil
+}
+
+func (dis *Dispatcher) subscribe(listenerObj interface{}) {
+	s, ok := dis.subscribers[listenerObj]
+	if !ok {
+		s = &subscriber{sync: dis.syncDelivery}
+		dis.subscribers[listenerObj] = s
+	}
+	s.refs++
+}
+
+func (dis *Dispatcher) unsubscribe(listenerObj interface{}) {
+	s, ok := dis.subscribers[listenerObj]
+	if !ok {
+		return
+	}
+	s.refs--
+	if s.refs <= 0 {
+		delete(dis.subscribers, listenerObj)
+	}
+}
+
+func (dis *Dispatcher) deliver(listenerObj Listener, event *Event, rev uint64) {
+	dis.push(dis.subscribers[listenerObj], rev, func() {
+		listenerObj.Event(event)
+	})
+}
+
+func (dis *Dispatcher) deliverModule(listenerObj ModuleListener, events []*Event, rev uint64) {
+	dis.push(dis.subscribers[listenerObj], rev, func() {
+		listenerObj.Event(events)
+	})
+}
+
+// push queues a delivery which belongs to revision rev
+func (dis *Dispatcher) push(s *subscriber, rev uint64, deliver func()) {
+	dis.revisions.add(rev)
+	needDrain := s.push(func() {
+		defer dis.revisions.done(rev)
+		deliver()
+	})
+	if needDrain {
+		dis.dirtyMux.Lock()
+		dis.dirty = append(dis.dirty, s)
+		dis.dirtyMux.Unlock()
+	}
+}
+
+// Drain delivers queued events on the calling goroutine, it only works with WithSyncDelivery.
+// a queue being drained by another goroutine is skipped,
+// so a listener which changes configurations in its callback receives the new events after the callback returns
+func (dis *Dispatcher) Drain() {
+	dis.dirtyMux.Lock()
+	dirty := dis.dirty
+	dis.dirty = nil
+	dis.dirtyMux.Unlock()
+	for _, s := range dirty {
+		s.tryDrain()
+	}
+}
+
+// Revision returns the revision of the latest dispatched event,
+// it increases on each DispatchEvent, DispatchModuleEvent and initial state replay
+func (dis *Dispatcher) Revision() uint64 {
+	return dis.revisions.latest()
+}
+
+// WaitForRevision blocks until events of rev and all revisions before it are delivered to listeners
+func (dis *Dispatcher) WaitForRevision(ctx context.Context, rev uint64) error {
+	return dis.revisions.wait(ctx, rev)
+}
+
+// state returns current configurations as Create events sorted by key
+func (dis *Dispatcher) state() []*Event {
+	if dis.stateLoader == nil {
+		openlog.Warn("no state loader, can not replay initial state")
+		return nil
+	}
+	state := dis.stateLoader()
+	sort.Slice(state, func(i, j int) bool {
+		return state[i].Key < state[j].Key
+	})
+	for _, e := range state {
+		e.EventType = Create
+	}
+	return state
+}
+
+func (dis *Dispatcher) replayState(listenerObj Listener, keys []string, o *RegisterOptions, rev uint64) {
+	for _, e := range o.filter(dis.state()) {
+		for _, key := range keys {
+			matched, err := regexp.MatchString(key, e.Key)
+			if err == nil && matched {
+				dis.deliver(listenerObj, e, rev)
+				break
+			}
+		}
+	}
+}
+
+func (dis *Dispatcher) replayModuleState(listenerObj ModuleListener, prefixes []string, o *RegisterOptions,
+	rev uint64) {
+	state := o.filter(dis.state())
+	if len(state) == 0 {
+		return
+	}
+	eventsList := dis.parseEvents(state)
+	for _, prefix := range prefixes {
+		if events, ok := eventsList[prefix]; ok {
+			dis.deliverModule(listenerObj, events, rev)
+		}
+	}
+}
+
+// RegisterModuleValidator registers validator for particular configuration prefixes
+func (dis *Dispatcher) RegisterModuleValidator(validator ModuleValidator, modulePrefixes ...string) error {
+	if validator == nil {
+		openlog.Error("nil validator supplied")
+		return ErrNilListener
+	}
+	dis.validatorMux.Lock()
+	defer dis.validatorMux.Unlock()
+	for _, prefix := range modulePrefixes {
+		validators, ok := dis.validators[prefix]
+		if !ok {
+			dis.validatorPrefixIndex.AddPrefix(prefix)
+		}
+		duplicated := false
+		for _, v := range validators {
+			if v == validator {
+				duplicated = true
+				break
 			}
 		}
+		if !duplicated {
+			dis.validators[prefix] = append(validators, validator)
+		}
 	}
+	return nil
+}
 
+// UnRegisterModuleValidator un-register validator for particular configuration prefixes
+func (dis *Dispatcher) UnRegisterModuleValidator(validator ModuleValidator, modulePrefixes ...string) error {
+	if validator == nil {
+		return ErrNilListener
+	}
+	dis.validatorMux.Lock()
+	defer dis.validatorMux.Unlock()
+	for _, prefix := range modulePrefixes {
+		validators, ok := dis.validators[prefix]
+		if !ok {
+			continue
+		}
+		newValidators := make([]ModuleValidator, 0)
+		for _, v := range validators {
+			if v == validator {
+				continue
+			}
+			newValidators = append(newValidators, v)
+		}
+		if len(newValidators) == 0 {
+			delete(dis.validators, prefix)
+			dis.validatorPrefixIndex.RemovePrefix(prefix)
+			continue
+		}
+		dis.validators[prefix] = newValidators
+	}
+	return nil
+}
+
+// Validate runs the validators registered for the prefixes of events.
+// events with the same prefix are validated together, the first rejection is returned as *ValidationError
+func (dis *Dispatcher) Validate(events []*Event) error {
+	dis.validatorMux.RLock()
+	defer dis.validatorMux.RUnlock()
+	if len(dis.validators) == 0 || len(events) == 0 {
+		return nil
+	}
+
+	// a key is validated by validators of all prefixes it has, like "pool" and "pool.size"
+	eventsList := make(map[string][]*Event)
+	for _, e := range events {
+		for _, prefix := range dis.validatorPrefixIndex.FindAllPrefixes(e.Key) {
+			eventsList[prefix] = append(eventsList[prefix], e)
+		}
+	}
+	prefixes := make([]string, 0, len(eventsList))
+	for prefix := range eventsList {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		for _, validator := range dis.validators[prefix] {
+			if err := validator.Validate(eventsList[prefix]); err != nil {
+				return &ValidationError{Prefix: prefix, Events: eventsList[prefix], Err: err}
+			}
+		}
+	}
 	return nil
 }
 
 // Event key with the same subscription prefix is placed in the same slice
 func (dis *Dispatcher) parseEvents(events []*Event) map[string][]*Event {
+	return groupEvents(&dis.modulePrefixIndex, events)
+}
+
+func groupEvents(index *PrefixIndex, events []*Event) map[string][]*Event {
 	var eventList = make(map[string][]*Event)
 	for _, event := range events {
 		// find first prefix from event.key
-		//registerKey := dis.findFirstRegisterPrefix(event.Key)
-		prefix := dis.modulePrefixIndex.FindPrefix(event.Key)
+		prefix := index.FindPrefix(event.Key)
 		if prefix == "" {
 			continue
 		}
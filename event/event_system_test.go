@@ -1,9 +1,12 @@
 package event_test
 
 import (
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-chassis/go-archaius/event"
 )
@@ -145,6 +148,26 @@ func TestDispatcher_DispatchModuleEvent(t *testing.T) {
 		}
 		assert.Len(t, lis2.eventKeys, 0)
 	})
+	t.Run("RegisterModuleEventWildcard", func(t *testing.T) {
+		dispatcher := event.NewDispatcher()
+		lis := &MListener{}
+		dispatcher.RegisterModuleListener(lis, "servicecomb.*.circuitBreaker")
+		lis.wg.Add(3)
+		dispatcher.DispatchModuleEvent([]*event.Event{
+			{
+				Key: "servicecomb.Consumer.circuitBreaker.enabled",
+			},
+			{
+				Key: "servicecomb.Consumer.isolation.timeout",
+			},
+			{
+				Key: "servicecomb.Provider.circuitBreaker.enabled",
+			},
+		})
+		lis.wg.Wait()
+		assert.Equal(t, []string{"servicecomb.Consumer.circuitBreaker.enabled",
+			"servicecomb.Provider.circuitBreaker.enabled"}, lis.eventKeys)
+	})
 	t.Run("UnRegisterModuleEventCovered", func(t *testing.T) {
 		dispatcher := event.NewDispatcher()
 		lis1 := &MListener{}
@@ -169,4 +192,253 @@ func TestDispatcher_DispatchModuleEvent(t *testing.T) {
 			assert.Equal(t, "aaa.bbb.ccc", lis2.eventKeys[0])
 		}
 	})
-}
\ No newline at end of file
+}
+
+type rejectValidator struct {
+	events []*event.Event
+}
+
+func (v *rejectValidator) Validate(events []*event.Event) error {
+	v.events = events
+	for _, e := range events {
+		if e.Value == "bad" {
+			return errors.New("bad value")
+		}
+	}
+	return nil
+}
+
+func TestDispatcher_Validate(t *testing.T) {
+	dispatcher := event.NewDispatcher()
+	v := &rejectValidator{}
+	assert.NoError(t, dispatcher.RegisterModuleValidator(v, "aaa.bbb"))
+	t.Run("accept", func(t *testing.T) {
+		err := dispatcher.Validate([]*event.Event{
+			{Key: "aaa.bbb.ccc", Value: "good"},
+			{Key: "ccc", Value: "bad"},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, v.events, 1)
+	})
+	t.Run("reject", func(t *testing.T) {
+		err := dispatcher.Validate([]*event.Event{
+			{Key: "aaa.bbb.ccc", Value: "good"},
+			{Key: "aaa.bbb.ddd", Value: "bad"},
+		})
+		var ve *event.ValidationError
+		if assert.True(t, errors.As(err, &ve)) {
+			assert.Equal(t, "aaa.bbb", ve.Prefix)
+			assert.Len(t, ve.Events, 2)
+		}
+	})
+	t.Run("unregister", func(t *testing.T) {
+		assert.NoError(t, dispatcher.UnRegisterModuleValidator(v, "aaa.bbb"))
+		err := dispatcher.Validate([]*event.Event{{Key: "aaa.bbb.ddd", Value: "bad"}})
+		assert.NoError(t, err)
+	})
+}
+
+type acceptValidator struct {
+	events []*event.Event
+}
+
+func (v *acceptValidator) Validate(events []*event.Event) error {
+	v.events = events
+	return nil
+}
+
+func TestDispatcher_ValidateNestedPrefixes(t *testing.T) {
+	dispatcher := event.NewDispatcher()
+	outer := &acceptValidator{}
+	inner := &rejectValidator{}
+	assert.NoError(t, dispatcher.RegisterModuleValidator(outer, "pool"))
+	assert.NoError(t, dispatcher.RegisterModuleValidator(inner, "pool.size"))
+
+	err := dispatcher.Validate([]*event.Event{
+		{Key: "pool.ttl", Value: "good"},
+		{Key: "pool.size.max", Value: "bad"},
+	})
+	var ve *event.ValidationError
+	if assert.True(t, errors.As(err, &ve)) {
+		assert.Equal(t, "pool.size", ve.Prefix)
+	}
+	assert.Len(t, outer.events, 2)
+	if assert.Len(t, inner.events, 1) {
+		assert.Equal(t, "pool.size.max", inner.events[0].Key)
+	}
+}
+
+type orderListener struct {
+	mu     sync.Mutex
+	events []*event.Event
+	wg     sync.WaitGroup
+}
+
+func (l *orderListener) Event(e *event.Event) {
+	l.mu.Lock()
+	l.events = append(l.events, e)
+	l.mu.Unlock()
+	l.wg.Done()
+}
+
+func TestDispatcher_RegisterListenerWithOptions(t *testing.T) {
+	state := []*event.Event{
+		{Key: "aaa.bbb", Value: 1, EventSource: "s"},
+		{Key: "ccc", Value: 2, EventSource: "s"},
+		{Key: "aaa.ccc", Value: 3, EventSource: "s"},
+	}
+	dispatcher := event.NewDispatcher(event.WithStateLoader(func() []*event.Event {
+		return state
+	}))
+	t.Run("replay state before updates", func(t *testing.T) {
+		lis := &orderListener{}
+		lis.wg.Add(4)
+		err := dispatcher.RegisterListenerWithOptions(lis, []string{"aaa.*"}, event.WithInitialState())
+		assert.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			dispatcher.DispatchEvent(&event.Event{Key: "aaa.bbb", Value: i, EventType: event.Update})
+		}
+		lis.wg.Wait()
+		if assert.Len(t, lis.events, 4) {
+			assert.Equal(t, "aaa.bbb", lis.events[0].Key)
+			assert.Equal(t, event.Create, lis.events[0].EventType)
+			assert.Equal(t, "aaa.ccc", lis.events[1].Key)
+			assert.Equal(t, 0, lis.events[2].Value)
+			assert.Equal(t, 1, lis.events[3].Value)
+		}
+	})
+	t.Run("replay module state", func(t *testing.T) {
+		lis := &MListener{}
+		lis.wg.Add(3)
+		err := dispatcher.RegisterModuleListenerWithOptions(lis, []string{"aaa"}, event.WithInitialState())
+		assert.NoError(t, err)
+		lis.wg.Wait()
+		assert.Equal(t, []string{"aaa.bbb", "aaa.ccc"}, lis.eventKeys)
+	})
+}
+
+func TestDispatcher_Filter(t *testing.T) {
+	dispatcher := event.NewDispatcher()
+	remote := &orderListener{}
+	deletion := &orderListener{}
+	module := &MListener{}
+	assert.NoError(t, dispatcher.RegisterListenerWithOptions(remote, []string{"aaa.*"},
+		event.FromSources("KieSource", "ConfigCenterSource")))
+	assert.NoError(t, dispatcher.RegisterListenerWithOptions(deletion, []string{"aaa.*"},
+		event.OfTypes(event.Delete)))
+	assert.NoError(t, dispatcher.RegisterModuleListenerWithOptions(module, []string{"aaa"},
+		event.FromSources("KieSource"), event.OfTypes(event.Update)))
+
+	remote.wg.Add(1)
+	deletion.wg.Add(1)
+	module.wg.Add(2)
+	events := []*event.Event{
+		{Key: "aaa.bbb", EventSource: "FileSource", EventType: event.Update},
+		{Key: "aaa.ccc", EventSource: "KieSource", EventType: event.Update},
+		{Key: "aaa.ddd", EventSource: "FileSource", EventType: event.Delete},
+	}
+	for _, e := range events {
+		dispatcher.DispatchEvent(e)
+	}
+	dispatcher.DispatchModuleEvent(events)
+	remote.wg.Wait()
+	deletion.wg.Wait()
+	module.wg.Wait()
+	if assert.Len(t, remote.events, 1) {
+		assert.Equal(t, "aaa.ccc", remote.events[0].Key)
+	}
+	if assert.Len(t, deletion.events, 1) {
+		assert.Equal(t, "aaa.ddd", deletion.events[0].Key)
+	}
+	assert.Equal(t, []string{"aaa.ccc"}, module.eventKeys)
+}
+
+type slowListener struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (l *slowListener) Event(e *event.Event) {
+	time.Sleep(10 * time.Millisecond)
+	l.mu.Lock()
+	l.keys = append(l.keys, e.Key)
+	l.mu.Unlock()
+}
+
+func (l *slowListener) received() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.keys...)
+}
+
+func TestDispatcher_WaitForRevision(t *testing.T) {
+	dispatcher := event.NewDispatcher()
+	lis := &slowListener{}
+	assert.NoError(t, dispatcher.RegisterListener(lis, "aaa.*"))
+	assert.Equal(t, uint64(0), dispatcher.Revision())
+	dispatcher.DispatchEvent(&event.Event{Key: "aaa.bbb"})
+	dispatcher.DispatchEvent(&event.Event{Key: "ccc"})
+	dispatcher.DispatchEvent(&event.Event{Key: "aaa.ccc"})
+	assert.Equal(t, uint64(3), dispatcher.Revision())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	assert.NoError(t, dispatcher.WaitForRevision(ctx, dispatcher.Revision()))
+	assert.Equal(t, []string{"aaa.bbb", "aaa.ccc"}, lis.received())
+
+	expired, cancelExpired := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelExpired()
+	assert.Equal(t, context.DeadlineExceeded, dispatcher.WaitForRevision(expired, dispatcher.Revision()+1))
+}
+
+type nestedListener struct {
+	dispatcher *event.Dispatcher
+	keys       []string
+}
+
+func (l *nestedListener) Event(e *event.Event) {
+	l.keys = append(l.keys, e.Key)
+	if e.Key == "aaa.bbb" {
+		// nested event is delivered after this callback returns
+		l.dispatcher.DispatchEvent(&event.Event{Key: "aaa.ccc"})
+		l.dispatcher.Drain()
+		l.keys = append(l.keys, "returned")
+	}
+}
+
+func TestDispatcher_SyncDelivery(t *testing.T) {
+	dispatcher := event.NewDispatcher(event.WithSyncDelivery())
+	lis := &nestedListener{dispatcher: dispatcher}
+	assert.NoError(t, dispatcher.RegisterListener(lis, "aaa.*"))
+	dispatcher.DispatchEvent(&event.Event{Key: "aaa.bbb"})
+	assert.Len(t, lis.keys, 0)
+	dispatcher.Drain()
+	assert.Equal(t, []string{"aaa.bbb", "returned", "aaa.ccc"}, lis.keys)
+	assert.NoError(t, dispatcher.WaitForRevision(context.Background(), dispatcher.Revision()))
+}
+
+type errorRecorder struct {
+	errs []*event.SourceError
+}
+
+func (r *errorRecorder) OnError(e *event.SourceError) {
+	r.errs = append(r.errs, e)
+}
+
+func TestDispatcher_DispatchErrorEvent(t *testing.T) {
+	dispatcher := event.NewDispatcher(event.WithSyncDelivery())
+	r := &errorRecorder{}
+	assert.NoError(t, dispatcher.RegisterErrorListener(r))
+	assert.NoError(t, dispatcher.RegisterErrorListener(r))
+	e := &event.SourceError{EventSource: "FileSource", Location: "/etc/app.yaml", Line: 3, Err: errors.New("bad")}
+	assert.NoError(t, dispatcher.DispatchErrorEvent(e))
+	dispatcher.Drain()
+	assert.Equal(t, []*event.SourceError{e}, r.errs)
+	assert.Equal(t, "FileSource [/etc/app.yaml] line 3: bad", e.Error())
+
+	assert.NoError(t, dispatcher.UnRegisterErrorListener(r))
+	assert.NoError(t, dispatcher.DispatchErrorEvent(e))
+	dispatcher.Drain()
+	assert.Len(t, r.errs, 1)
+	assert.Error(t, dispatcher.DispatchErrorEvent(nil))
+}
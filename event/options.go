@@ -0,0 +1,86 @@
+package event
+
+// StateLoader returns current configurations as events,
+// dispatcher uses it to replay state to listeners registered with WithInitialState
+type StateLoader func() []*Event
+
+// DispatcherOption is a func
+type DispatcherOption func(dis *Dispatcher)
+
+// WithStateLoader tells dispatcher how to get current configurations
+func WithStateLoader(loader StateLoader) DispatcherOption {
+	return func(dis *Dispatcher) {
+		dis.stateLoader = loader
+	}
+}
+
+// WithSyncDelivery makes listeners receive events on the goroutine which calls Drain,
+// instead of a goroutine of each listener, it makes tests deterministic
+func WithSyncDelivery() DispatcherOption {
+	return func(dis *Dispatcher) {
+		dis.syncDelivery = true
+	}
+}
+
+// RegisterOptions holds the options of a listener registration
+type RegisterOptions struct {
+	InitialState bool
+	// Sources and Types filter events before they are queued, empty means no filter
+	Sources []string
+	Types   []string
+}
+
+func (o *RegisterOptions) accept(e *Event) bool {
+	return contains(o.Sources, e.EventSource) && contains(o.Types, e.EventType)
+}
+
+// filter returns the events accepted by options
+func (o *RegisterOptions) filter(events []*Event) []*Event {
+	if len(o.Sources) == 0 && len(o.Types) == 0 {
+		return events
+	}
+	accepted := make([]*Event, 0, len(events))
+	for _, e := range events {
+		if o.accept(e) {
+			accepted = append(accepted, e)
+		}
+	}
+	return accepted
+}
+
+func contains(list []string, s string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterOption is a func
+type RegisterOption func(options *RegisterOptions)
+
+// WithInitialState delivers Create events of all current matching keys to the new listener,
+// they go through the same ordered queue as later updates and arrive before any of them
+func WithInitialState() RegisterOption {
+	return func(options *RegisterOptions) {
+		options.InitialState = true
+	}
+}
+
+// FromSources only delivers events generated by the given sources, like "KieSource"
+func FromSources(sourceNames ...string) RegisterOption {
+	return func(options *RegisterOptions) {
+		options.Sources = append(options.Sources, sourceNames...)
+	}
+}
+
+// OfTypes only delivers events of the given types, like event.Update and event.Delete
+func OfTypes(eventTypes ...string) RegisterOption {
+	return func(options *RegisterOptions) {
+		options.Types = append(options.Types, eventTypes...)
+	}
+}
@@ -0,0 +1,86 @@
+package event
+
+import (
+	"context"
+	"sync"
+)
+
+// revisions counts dispatches and tracks which of them are delivered to all listeners
+type revisions struct {
+	mu sync.Mutex
+	// current is the revision of the latest dispatch
+	current uint64
+	// every revision not greater than delivered is delivered
+	delivered uint64
+	// pending is the number of undelivered events of each revision
+	pending map[uint64]int
+	changed chan struct{}
+}
+
+func newRevisions() *revisions {
+	return &revisions{
+		pending: make(map[uint64]int),
+		changed: make(chan struct{}),
+	}
+}
+
+// begin allocates a new revision, it is held until done is called
+func (r *revisions) begin() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current++
+	r.pending[r.current] = 1
+	return r.current
+}
+
+func (r *revisions) add(rev uint64) {
+	r.mu.Lock()
+	r.pending[rev]++
+	r.mu.Unlock()
+}
+
+func (r *revisions) done(rev uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[rev]--
+	if r.pending[rev] > 0 {
+		return
+	}
+	delete(r.pending, rev)
+	advanced := false
+	for r.delivered < r.current {
+		if _, ok := r.pending[r.delivered+1]; ok {
+			break
+		}
+		r.delivered++
+		advanced = true
+	}
+	if advanced {
+		close(r.changed)
+		r.changed = make(chan struct{})
+	}
+}
+
+func (r *revisions) latest() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// wait blocks until rev and all revisions before it are delivered
+func (r *revisions) wait(ctx context.Context, rev uint64) error {
+	for {
+		r.mu.Lock()
+		if r.delivered >= rev {
+			r.mu.Unlock()
+			return nil
+		}
+		changed := r.changed
+		r.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
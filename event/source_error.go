@@ -0,0 +1,92 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SourceError describes a part of a config source which fails to load, like a file with syntax error.
+// the source keeps the last good configurations of it until it loads again
+type SourceError struct {
+	EventSource string
+	// Location is where the error is, like the path of a file
+	Location string
+	// Line is the line of the error in file, 0 means unknown
+	Line int
+	// Err is nil if the location loads again, it tells listeners the error is resolved
+	Err  error
+	Time time.Time
+}
+
+func (e *SourceError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s [%s] line %d: %s", e.EventSource, e.Location, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s [%s]: %s", e.EventSource, e.Location, e.Err)
+}
+
+// Unwrap returns the error of source
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorListener receives errors of config sources, so that a broken config file can be alerted
+type ErrorListener interface {
+	OnError(e *SourceError)
+}
+
+// RegisterErrorListener registers listener for errors of all sources
+func (dis *Dispatcher) RegisterErrorListener(listenerObj ErrorListener) error {
+	if listenerObj == nil {
+		return ErrNilListener
+	}
+	dis.mu.Lock()
+	defer dis.mu.Unlock()
+	for _, l := range dis.errorListeners {
+		if l == listenerObj {
+			return nil
+		}
+	}
+	dis.errorListeners = append(dis.errorListeners, listenerObj)
+	dis.subscribe(listenerObj)
+	return nil
+}
+
+// UnRegisterErrorListener un-register listener of errors
+func (dis *Dispatcher) UnRegisterErrorListener(listenerObj ErrorListener) error {
+	if listenerObj == nil {
+		return ErrNilListener
+	}
+	dis.mu.Lock()
+	defer dis.mu.Unlock()
+	listeners := make([]ErrorListener, 0, len(dis.errorListeners))
+	for _, l := range dis.errorListeners {
+		if l == listenerObj {
+			dis.unsubscribe(listenerObj)
+			continue
+		}
+		listeners = append(listeners, l)
+	}
+	dis.errorListeners = listeners
+	return nil
+}
+
+// DispatchErrorEvent sends an error of source to error listeners,
+// it is queued with config events, so listeners receive them in order
+func (dis *Dispatcher) DispatchErrorEvent(e *SourceError) error {
+	if e == nil {
+		return errors.New("empty error provided")
+	}
+	rev := dis.revisions.begin()
+	defer dis.revisions.done(rev)
+	dis.mu.RLock()
+	defer dis.mu.RUnlock()
+	for _, l := range dis.errorListeners {
+		listenerObj := l
+		dis.push(dis.subscribers[listenerObj], rev, func() {
+			listenerObj.OnError(e)
+		})
+	}
+	return nil
+}
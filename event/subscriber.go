@@ -0,0 +1,58 @@
+package event
+
+import "sync"
+
+// subscriber delivers events to one listener in the order they are dispatched
+type subscriber struct {
+	mu      sync.Mutex
+	queue   []func()
+	running bool
+	// refs is the number of keys or prefixes the listener registered
+	refs int
+	// sync subscriber does not start a goroutine, its queue is drained by the caller of Dispatcher.Drain
+	sync bool
+}
+
+// push queues a delivery, it returns true if the queue must be drained by caller
+func (s *subscriber) push(deliver func()) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, deliver)
+	if s.sync {
+		return true
+	}
+	if !s.running {
+		s.running = true
+		go s.drain()
+	}
+	return false
+}
+
+// tryDrain delivers queued events on the calling goroutine,
+// it does nothing if the queue is being drained, then the events are delivered by the running one
+func (s *subscriber) tryDrain() {
+	s.mu.Lock()
+	if s.running || len(s.queue) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.mu.Unlock()
+	s.drain()
+}
+
+func (s *subscriber) drain() {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		deliver := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		deliver()
+	}
+}
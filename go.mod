@@ -1,6 +1,7 @@
 module github.com/go-chassis/go-archaius
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/Shonminh/apollo-client v0.4.0
 	github.com/fsnotify/fsnotify v1.4.7
 	github.com/go-chassis/foundation v0.4.0
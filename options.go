@@ -2,7 +2,10 @@ package archaius
 
 import (
 	"crypto/tls"
+	"time"
 
+	"github.com/go-chassis/go-archaius/source/cli"
+	"github.com/go-chassis/go-archaius/source/env"
 	"github.com/go-chassis/go-archaius/source/util"
 )
 
@@ -43,27 +46,133 @@ type Options struct {
 	RemoteInfo    *RemoteInfo
 	RemoteSource  string
 	UseCLISource  bool
+	CLIOptions    []cli.Option
 	UseENVSource  bool
+	ENVOptions    []env.Option
 	UseMemSource  bool
+	SyncDispatch  bool
+
+	// FilePriorities gives priority of required and optional files, lower value means higher priority
+	FilePriorities map[string]uint32
+	// RecursiveDirs, IncludeFiles and ExcludeFiles work for directories and globs of required and optional files
+	RecursiveDirs bool
+	IncludeFiles  []string
+	ExcludeFiles  []string
+	// FilePollInterval makes required and optional files polled instead of being watched by fsnotify
+	FilePollInterval time.Duration
+	// FileDebounceWindow is the time required and optional files must be quiet after a change before reloading
+	FileDebounceWindow time.Duration
+
+	// Profiles load overlays of required and optional files, like app-prod.yaml for app.yaml
+	Profiles []string
+	// LocalOverlay loads local overlays of required and optional files, like app.local.yaml for app.yaml
+	LocalOverlay bool
+	// WritableFile is the yaml file which Set and Delete write to, so that changes survive restart
+	WritableFile string
+	// SecretDirs maps directories of mounted secrets to the prefix of their keys
+	SecretDirs map[string]string
+	// ConfigMapDirs are directories of mounted config maps, ConfigMapHandler converts their files
+	ConfigMapDirs    []string
+	ConfigMapHandler util.FileHandler
+	// ReloadOnSIGHUP makes archaius reload all sources when the process receives SIGHUP
+	ReloadOnSIGHUP bool
 }
 
 //Option is a func
 type Option func(options *Options)
 
-//WithRequiredFiles tell archaius to manage files, if not exist will return error
+//WithRequiredFiles tell archaius to manage files, if not exist will return error.
+//a file can be a directory, or a glob like "conf/**/*.yaml" which must match at least one file
 func WithRequiredFiles(f []string) Option {
 	return func(options *Options) {
 		options.RequiredFiles = f
 	}
 }
 
-//WithOptionalFiles tell archaius to manage files, if not exist will NOT return error
+//WithOptionalFiles tell archaius to manage files, if not exist will NOT return error.
+//a file can be a directory or a glob
 func WithOptionalFiles(f []string) Option {
 	return func(options *Options) {
 		options.OptionalFiles = f
 	}
 }
 
+//WithFilePriorities tell archaius priority of files given by WithRequiredFiles and WithOptionalFiles,
+//if key conflicts, the file with lower value wins, files not in map have priority 0.
+//if priorities are the same, the file listed later wins
+func WithFilePriorities(priorities map[string]uint32) Option {
+	return func(options *Options) {
+		options.FilePriorities = priorities
+	}
+}
+
+//WithRecursiveDirs includes files of sub directories for directories given by WithRequiredFiles and WithOptionalFiles
+func WithRecursiveDirs() Option {
+	return func(options *Options) {
+		options.RecursiveDirs = true
+	}
+}
+
+//WithIncludeFiles only includes files matching one of patterns, like "*.yaml",
+//in directories and globs given by WithRequiredFiles and WithOptionalFiles
+func WithIncludeFiles(patterns ...string) Option {
+	return func(options *Options) {
+		options.IncludeFiles = append(options.IncludeFiles, patterns...)
+	}
+}
+
+//WithExcludeFiles skips files matching one of patterns, like "*.bak",
+//in directories and globs given by WithRequiredFiles and WithOptionalFiles
+func WithExcludeFiles(patterns ...string) Option {
+	return func(options *Options) {
+		options.ExcludeFiles = append(options.ExcludeFiles, patterns...)
+	}
+}
+
+//WithFilePolling polls files given by WithRequiredFiles and WithOptionalFiles at interval,
+//instead of watching them by fsnotify, it works on filesystems without inotify, like NFS.
+//files are polled anyway if fsnotify does not work
+func WithFilePolling(interval time.Duration) Option {
+	return func(options *Options) {
+		options.FilePollInterval = interval
+	}
+}
+
+//WithFileDebounce reloads files given by WithRequiredFiles and WithOptionalFiles once they are quiet for window
+//after a change, so that the events of one save cause one reload
+func WithFileDebounce(window time.Duration) Option {
+	return func(options *Options) {
+		options.FileDebounceWindow = window
+	}
+}
+
+//WithProfiles activates profiles, given app.yaml, archaius also loads app-prod.yaml and app-eu.yaml
+//for WithProfiles("prod", "eu") if they exist. an overlay has higher priority than its file,
+//and a later profile has higher priority than an earlier one.
+//profiles can also be set by command line --archaius.profiles.active=prod,eu
+//or environment variable ARCHAIUS_PROFILES_ACTIVE=prod,eu, which win over this option
+func WithProfiles(profiles ...string) Option {
+	return func(options *Options) {
+		options.Profiles = profiles
+	}
+}
+
+//WithLocalOverlay loads local overlays of files if they exist, like app.local.yaml for app.yaml,
+//it has higher priority than profile overlays
+func WithLocalOverlay() Option {
+	return func(options *Options) {
+		options.LocalOverlay = true
+	}
+}
+
+//WithWritableFile makes Set and Delete also write the yaml file, comments and order of it are kept.
+//it is created if it does not exist, and has higher priority than other files
+func WithWritableFile(file string) Option {
+	return func(options *Options) {
+		options.WritableFile = file
+	}
+}
+
 //WithDefaultFileHandler let user custom handler
 //you can decide how to convert file into kv pairs
 func WithDefaultFileHandler(handler util.FileHandler) Option {
@@ -81,18 +190,22 @@ func WithRemoteSource(provider string, ri *RemoteInfo) Option {
 }
 
 //WithCommandLineSource enable cmd line source
-//archaius will read command line params as key value
-func WithCommandLineSource() Option {
+//archaius will read command line params as key value, opts bind a flag set or give args,
+//like cli.WithFlagSet(flag.CommandLine). Init fails if command line is wrong, or flag.ErrHelp is returned for "-h"
+func WithCommandLineSource(opts ...cli.Option) Option {
 	return func(options *Options) {
 		options.UseCLISource = true
+		options.CLIOptions = opts
 	}
 }
 
 //WithENVSource enable env source
-//archaius will read ENV as key value
-func WithENVSource() Option {
+//archaius will read ENV as key value, opts filter variables by prefix and map names to keys,
+//like env.WithPrefix("MYAPP_"), env.WithNestingSeparator("__"), env.WithLowercase() and env.BindEnv
+func WithENVSource(opts ...env.Option) Option {
 	return func(options *Options) {
 		options.UseENVSource = true
+		options.ENVOptions = opts
 	}
 }
 
@@ -103,9 +216,56 @@ func WithMemorySource() Option {
 	}
 }
 
+//WithSecretDir loads each file of dir as a key value, like mounted kubernetes or docker secrets.
+//key is prefix plus file name, like "secret.db.password" for prefix "secret.", values are redacted by WriteTo
+func WithSecretDir(dir, prefix string) Option {
+	return func(options *Options) {
+		if options.SecretDirs == nil {
+			options.SecretDirs = make(map[string]string)
+		}
+		options.SecretDirs[dir] = prefix
+	}
+}
+
+//WithConfigMapSource loads files of mounted config map directories, like kubernetes config maps.
+//a rotation of "..data" symlink updates keys in one batch, and keys removed from config map are deleted.
+//if key conflicts, the directory given later wins. nil handler chooses handler by file extension
+func WithConfigMapSource(dirs []string, handler util.FileHandler) Option {
+	return func(options *Options) {
+		options.ConfigMapDirs = dirs
+		options.ConfigMapHandler = handler
+	}
+}
+
+//WithReloadOnSIGHUP calls ReloadAll each time the process receives SIGHUP,
+//so that "kill -HUP" picks up a fixed config file or forces a pull of remote configs
+func WithReloadOnSIGHUP() Option {
+	return func(options *Options) {
+		options.ReloadOnSIGHUP = true
+	}
+}
+
+//WithSyncDispatch makes listeners receive events before the change which generates them returns,
+//for example, listeners are called before Set returns. it helps to write deterministic tests
+func WithSyncDispatch() Option {
+	return func(options *Options) {
+		options.SyncDispatch = true
+	}
+}
+
 //FileOptions for AddFile func
 type FileOptions struct {
-	Handler util.FileHandler
+	Handler   util.FileHandler
+	Priority  uint32
+	Recursive bool
+	Include   []string
+	Exclude   []string
+	// PollInterval makes file polled instead of being watched by fsnotify
+	PollInterval time.Duration
+	// DebounceWindow is the time file must be quiet after a change before reloading
+	DebounceWindow time.Duration
+	// Writable makes file the target of Set and Delete
+	Writable bool
 }
 
 //FileOption is a func
@@ -118,3 +278,53 @@ func WithFileHandler(h util.FileHandler) FileOption {
 	}
 
 }
+
+//WithRecursive includes files of sub directories if file is a directory
+func WithRecursive() FileOption {
+	return func(options *FileOptions) {
+		options.Recursive = true
+	}
+}
+
+//WithPolling polls file at interval instead of watching it by fsnotify
+func WithPolling(interval time.Duration) FileOption {
+	return func(options *FileOptions) {
+		options.PollInterval = interval
+	}
+}
+
+//WithDebounce reloads file once it is quiet for window after a change
+func WithDebounce(window time.Duration) FileOption {
+	return func(options *FileOptions) {
+		options.DebounceWindow = window
+	}
+}
+
+//WithWritable makes Set and Delete also write the yaml file, it is created if it does not exist
+func WithWritable() FileOption {
+	return func(options *FileOptions) {
+		options.Writable = true
+	}
+}
+
+//WithInclude only includes files matching one of patterns, like "*.yaml", if file is a directory or glob
+func WithInclude(patterns ...string) FileOption {
+	return func(options *FileOptions) {
+		options.Include = append(options.Include, patterns...)
+	}
+}
+
+//WithExclude skips files matching one of patterns, like "*.bak", if file is a directory or glob
+func WithExclude(patterns ...string) FileOption {
+	return func(options *FileOptions) {
+		options.Exclude = append(options.Exclude, patterns...)
+	}
+}
+
+//WithFilePriority set priority of file, if key conflicts, the file with lower value wins,
+//if priorities are the same, the file added later wins
+func WithFilePriority(priority uint32) FileOption {
+	return func(options *FileOptions) {
+		options.Priority = priority
+	}
+}
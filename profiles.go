@@ -0,0 +1,117 @@
+package archaius
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-chassis/go-archaius/source/cli"
+)
+
+const (
+	//ProfilesKey is the command line key of active profiles, like --archaius.profiles.active=prod,eu
+	//or --archaius.profiles.active prod,eu
+	ProfilesKey = "archaius.profiles.active"
+	//ProfilesEnv is the environment variable of active profiles, like ARCHAIUS_PROFILES_ACTIVE=prod,eu
+	ProfilesEnv = "ARCHAIUS_PROFILES_ACTIVE"
+)
+
+// overlays describes the files loaded over each config file, it is decided by Init
+type overlays struct {
+	profiles []string
+	local    bool
+}
+
+var activeOverlays overlays
+
+// newOverlays resolves active profiles, command line wins over environment variable, which wins over WithProfiles
+func newOverlays(o *Options) overlays {
+	profiles := o.Profiles
+	if v, ok := os.LookupEnv(ProfilesEnv); ok {
+		profiles = splitProfiles(v)
+	}
+	if v, ok := profilesArg(o); ok {
+		profiles = splitProfiles(v)
+	}
+	return overlays{profiles: profiles, local: o.LocalOverlay}
+}
+
+// profilesArg returns the active profiles given by command line, like "--archaius.profiles.active prod",
+// the arguments given by WithCommandLineSource are parsed like command line source does, the last one wins
+func profilesArg(o *Options) (string, bool) {
+	co := cli.Options{Args: os.Args[1:]}
+	for _, opt := range o.CLIOptions {
+		opt(&co)
+	}
+	// flags declared by user are not bound here, errors are reported by command line source
+	cmdSource, _ := cli.NewCommandlineSource(cli.WithArgs(co.Args))
+	value, err := cmdSource.GetConfigurationByKey(ProfilesKey)
+	if err != nil {
+		return "", false
+	}
+	if list, ok := value.([]interface{}); ok {
+		value = list[len(list)-1]
+	}
+	v, ok := value.(string)
+	return v, ok
+}
+
+func splitProfiles(s string) []string {
+	profiles := make([]string, 0)
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles
+}
+
+// levels is the number of files loaded for each config file
+func (ov overlays) levels() int {
+	n := 1 + len(ov.profiles)
+	if ov.local {
+		n++
+	}
+	return n
+}
+
+// files returns file and its overlays in order of increasing priority,
+// like app.yaml, app-prod.yaml, app-eu.yaml and app.local.yaml. directories and globs have no overlay
+func (ov overlays) files(file string) []string {
+	if isGlob(file) {
+		return []string{file}
+	}
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		return []string{file}
+	}
+	ext := filepath.Ext(file)
+	name := strings.TrimSuffix(file, ext)
+	files := []string{file}
+	for _, p := range ov.profiles {
+		files = append(files, name+"-"+p+ext)
+	}
+	if ov.local {
+		files = append(files, name+".local"+ext)
+	}
+	return files
+}
+
+// priority returns the priority of the i-th file returned by files, for a config file with priority p.
+// overlays of a file have higher priority (lower value) than it,
+// and the order between config files with different priorities is kept.
+// p is usable up to (math.MaxUint32-levels+1)/levels, a greater one is treated as it, so that it never overflows
+func (ov overlays) priority(p uint32, i int) uint32 {
+	levels := uint32(ov.levels())
+	if max := (math.MaxUint32 - (levels - 1)) / levels; p > max {
+		p = max
+	}
+	return p*levels + (levels - 1 - uint32(i))
+}
+
+//Profiles returns the active profiles
+func Profiles() []string {
+	profiles := make([]string, len(activeOverlays.profiles))
+	copy(profiles, activeOverlays.profiles)
+	return profiles
+}
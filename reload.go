@@ -0,0 +1,44 @@
+package archaius
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-chassis/openlog"
+)
+
+// stopReloadSignal stops the handler of SIGHUP started by Init
+var stopReloadSignal func()
+
+//ReloadAll reads all sources again, like a config file fixed by operators, environment variables changed
+//by reloading an environment file, or remote configs pulled immediately. the changes are sent to listeners
+//before it returns, unless ctx is done. errors of all sources are returned together
+func ReloadAll(ctx context.Context) error {
+	return manager.ReloadAll(ctx)
+}
+
+// handleReloadSignal calls ReloadAll each time SIGHUP is received, until stop is called
+func handleReloadSignal() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-signals:
+				openlog.Info("SIGHUP received, reload all sources")
+				if err := ReloadAll(context.Background()); err != nil {
+					openlog.Error(err.Error())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
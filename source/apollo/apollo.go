@@ -3,6 +3,8 @@ package apollo
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	apollo "github.com/Shonminh/apollo-client"
@@ -18,6 +20,11 @@ type Source struct {
 	sync.RWMutex
 	eventHandler    source.EventHandler
 	ignoreNamespace bool
+	// namespaces are watched by apollo client, they are stripped from keys of client cache if ignoreNamespace
+	namespaces []string
+	// accepted is the configs accepted by event handler, apollo client caches a change before it is validated,
+	// so reads are served from accepted instead of client cache
+	accepted map[string]interface{}
 }
 
 const (
@@ -37,6 +44,8 @@ const (
 
 var (
 	gStartApolloOnce sync.Once
+	// configCacheMap returns the configs cached by apollo client
+	configCacheMap = apollo.GetConfigCacheMap
 )
 
 // init function
@@ -64,6 +73,11 @@ func NewApolloSource(remoteInfo *archaius.RemoteInfo) (source.ConfigSource, erro
 		apollo.WithLogFunc(Debugf, Infof, Errorf),
 	}
 
+	for _, ns := range strings.Split(remoteInfo.DefaultDimension[NamespaceList], ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			as.namespaces = append(as.namespaces, ns)
+		}
+	}
 	if remoteInfo.DefaultDimension[IgnoreNameSpace] == Ignore {
 		as.ignoreNamespace = true // ignore key
 		opts = append(opts, apollo.IgnoreNameSpace())
@@ -78,23 +92,27 @@ func NewApolloSource(remoteInfo *archaius.RemoteInfo) (source.ConfigSource, erro
 	return as, nil
 }
 
-// GetConfigurations get config cache map from apollo client.
+// GetConfigurations get accepted config keys, the first call takes configs from apollo client cache.
 func (as *Source) GetConfigurations() (map[string]interface{}, error) {
 	configMap := make(map[string]interface{})
 	as.Lock()
-	apolloCache := apollo.GetConfigCacheMap()
-	for k := range apolloCache {
+	if as.accepted == nil {
+		as.accepted = as.cachedConfigs()
+	}
+	for k := range as.accepted {
 		configMap[k] = apolloSourceName
 	}
 	as.Unlock()
 	return configMap, nil
 }
 
-// GetConfigurationByKey get config by key, key's format is: {namespace}.field1.field2
+// GetConfigurationByKey get accepted config by key, key's format is: {namespace}.field1.field2
 func (as *Source) GetConfigurationByKey(key string) (interface{}, error) {
-	value, err := apollo.GetConfigByKey(key)
-	if err != nil {
-		return nil, errors.New("GetConfigByKey failed, error=" + err.Error())
+	as.RLock()
+	defer as.RUnlock()
+	value, ok := as.accepted[key]
+	if !ok {
+		return nil, errors.New("GetConfigByKey failed, error=key " + key + " does not exist")
 	}
 	return value, nil
 }
@@ -123,6 +141,9 @@ func (as *Source) SetPriority(priority int) {
 // Cleanup clean apollo cache from apollo client
 func (as *Source) Cleanup() error {
 	apollo.Cleanup()
+	as.Lock()
+	as.accepted = nil
+	as.Unlock()
 	return nil
 }
 
@@ -148,30 +169,115 @@ func (as *Source) Delete(key string) error {
 
 // UpdateCallback callback function when config updates
 func (as *Source) UpdateCallback(apolloEvent *apollo.ChangeEvent) error {
-	if as.eventHandler != nil {
-		var es = make([]*event.Event, len(apolloEvent.Changes))
-		for i, c := range apolloEvent.Changes {
-			eventType := transformEventType(c.ChangeType)
-			if eventType == "" {
-				continue
-			}
-
-			e := &event.Event{
-				EventSource: apolloSourceName,
-				EventType:   eventType,
-				Key:         apolloEvent.Namespace + "." + c.Key, // to make sure key is prefix with namespace
-				Value:       c.NewValue,
-			}
-			if as.ignoreNamespace {
-				e.Key = c.Key
-			}
-
-			as.eventHandler.OnEvent(e)
-			es[i] = e
+	if as.eventHandler == nil {
+		return nil
+	}
+	es := make([]*event.Event, 0, len(apolloEvent.Changes))
+	for _, c := range apolloEvent.Changes {
+		eventType := transformEventType(c.ChangeType)
+		if eventType == "" {
+			continue
+		}
+
+		e := &event.Event{
+			EventSource: apolloSourceName,
+			EventType:   eventType,
+			Key:         apolloEvent.Namespace + "." + c.Key, // to make sure key is prefix with namespace
+			Value:       c.NewValue,
+		}
+		if as.ignoreNamespace {
+			e.Key = c.Key
 		}
-		as.eventHandler.OnModuleEvent(es)
+		es = append(es, e)
 	}
-	return nil
+	if len(es) == 0 {
+		return nil
+	}
+	// apollo client already cached the change, so it is applied to a copy of accepted configs,
+	// which replaces accepted configs only if the event handler accepts the change
+	as.RLock()
+	next := make(map[string]interface{}, len(as.accepted)+len(es))
+	for k, v := range as.accepted {
+		next[k] = v
+	}
+	as.RUnlock()
+	for _, e := range es {
+		if e.EventType == event.Delete {
+			delete(next, e.Key)
+			continue
+		}
+		next[e.Key] = e.Value
+	}
+	return as.publish(as.eventHandler, es, next)
+}
+
+// Reload applies the configs of apollo client cache which are not accepted yet, like a change rejected before
+func (as *Source) Reload(handler source.EventHandler) error {
+	next := as.cachedConfigs()
+	es := make([]*event.Event, 0)
+	as.RLock()
+	for k, v := range next {
+		old, ok := as.accepted[k]
+		switch {
+		case !ok:
+			es = append(es, &event.Event{EventSource: apolloSourceName, EventType: event.Create, Key: k, Value: v})
+		case old != v:
+			es = append(es, &event.Event{EventSource: apolloSourceName, EventType: event.Update, Key: k, Value: v})
+		}
+	}
+	for k := range as.accepted {
+		if _, ok := next[k]; !ok {
+			es = append(es, &event.Event{EventSource: apolloSourceName, EventType: event.Delete, Key: k})
+		}
+	}
+	as.RUnlock()
+	if len(es) == 0 {
+		return nil
+	}
+	sort.Slice(es, func(i, j int) bool {
+		return es[i].Key < es[j].Key
+	})
+	return as.publish(handler, es, next)
+}
+
+// cachedConfigs returns the configs of apollo client cache,
+// keys are in the same format as the ones of UpdateCallback, without namespace if ignoreNamespace
+func (as *Source) cachedConfigs() map[string]interface{} {
+	configs := make(map[string]interface{})
+	for k, v := range configCacheMap() {
+		configs[as.cacheKey(k)] = v
+	}
+	return configs
+}
+
+func (as *Source) cacheKey(k string) string {
+	if !as.ignoreNamespace {
+		return k
+	}
+	for _, ns := range as.namespaces {
+		if strings.HasPrefix(k, ns+".") {
+			return strings.TrimPrefix(k, ns+".")
+		}
+	}
+	return k
+}
+
+// publish delivers es to handler, and replaces accepted configs by next if es are accepted
+func (as *Source) publish(handler source.EventHandler, es []*event.Event, next map[string]interface{}) error {
+	as.RLock()
+	old := as.accepted
+	as.RUnlock()
+	commit := func() {
+		as.Lock()
+		as.accepted = next
+		as.Unlock()
+	}
+	rollback := func() {
+		as.Lock()
+		as.accepted = old
+		as.Unlock()
+	}
+	return source.CommitModuleEvent(handler, es, commit, rollback)
 }
 
 // transformEventType transform change type
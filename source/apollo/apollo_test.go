@@ -0,0 +1,53 @@
+package apollo
+
+import (
+	"testing"
+
+	apollo "github.com/Shonminh/apollo-client"
+	"github.com/go-chassis/go-archaius/event"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordHandler struct {
+	events []*event.Event
+}
+
+func (h *recordHandler) OnEvent(e *event.Event) {}
+
+func (h *recordHandler) OnModuleEvent(events []*event.Event) {
+	h.events = append(h.events, events...)
+}
+
+func TestReloadIgnoreNamespace(t *testing.T) {
+	cache := map[string]string{"application.timeout": "1"}
+	configCacheMap = func() map[string]string { return cache }
+	defer func() { configCacheMap = apollo.GetConfigCacheMap }()
+
+	as := &Source{ignoreNamespace: true, namespaces: []string{"application"}}
+	configs, err := as.GetConfigurations()
+	assert.NoError(t, err)
+	assert.Contains(t, configs, "timeout")
+
+	h := &recordHandler{}
+	as.eventHandler = h
+	cache["application.retry"] = "2"
+	err = as.UpdateCallback(&apollo.ChangeEvent{Namespace: "application",
+		Changes: []*apollo.ConfigChange{{Key: "retry", NewValue: "2", ChangeType: apollo.ADDED}}})
+	assert.NoError(t, err)
+	assert.Len(t, h.events, 1)
+	v, err := as.GetConfigurationByKey("retry")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", v)
+
+	// the cache has nothing new
+	h.events = nil
+	assert.NoError(t, as.Reload(h))
+	assert.Empty(t, h.events)
+
+	cache["application.retry"] = "3"
+	assert.NoError(t, as.Reload(h))
+	if assert.Len(t, h.events, 1) {
+		assert.Equal(t, event.Update, h.events[0].EventType)
+		assert.Equal(t, "retry", h.events[0].Key)
+	}
+}
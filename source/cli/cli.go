@@ -18,11 +18,14 @@
 package cli
 
 import (
+	"flag"
+	"fmt"
 	"os"
 	"strings"
 	"sync"
 
 	"github.com/go-chassis/go-archaius/source"
+	"github.com/go-chassis/openlog"
 )
 
 //const
@@ -31,42 +34,182 @@ const (
 	commandlinePriority = 2
 )
 
+//Options is options of command line source
+type Options struct {
+	// Args are parsed instead of os.Args[1:]
+	Args []string
+	// FlagSet declares flags, they are keys with their defaults, and values are checked by their types
+	FlagSet *flag.FlagSet
+}
+
+//Option is a func
+type Option func(options *Options)
+
+//WithArgs parses args instead of os.Args[1:]
+func WithArgs(args []string) Option {
+	return func(options *Options) {
+		options.Args = args
+	}
+}
+
+//WithFlagSet binds fs, each declared flag is a key, its default is the value unless it is given by args.
+//notice defaults win over sources with lower priority like files, because they are given by command line source.
+//"-h" or "--help" prints usage of fs, which lists the declared keys, and flag.ErrHelp is returned
+func WithFlagSet(fs *flag.FlagSet) Option {
+	return func(options *Options) {
+		options.FlagSet = fs
+	}
+}
+
 //Source is source for all configuration
 type Source struct {
 	sync.RWMutex
 	Configurations map[string]interface{}
 
+	// args are the arguments which are not flags, and the ones after "--"
+	args     []string
 	priority int
 }
 
-//NewCommandlineConfigSource defines a function used for creating configuration source
+//NewCommandlineConfigSource defines a function used for creating configuration source,
+//errors of command line are logged, use NewCommandlineSource to get them
 func NewCommandlineConfigSource() source.ConfigSource {
+	cmdlineConfig, err := NewCommandlineSource()
+	if err != nil {
+		openlog.Error("parse command line failed: " + err.Error())
+	}
+	return cmdlineConfig
+}
+
+//NewCommandlineSource parses command line, it supports "--key=value", "--key value", boolean "--flag",
+//and one dash like "-k=v". a key given more than once is a list, and "--" ends flags.
+//the source is returned with the flags parsed so far even if there is an error
+func NewCommandlineSource(opts ...Option) (*Source, error) {
+	o := Options{Args: os.Args[1:]}
+	for _, opt := range opts {
+		opt(&o)
+	}
 	cmdlineConfig := new(Source)
 	cmdlineConfig.priority = commandlinePriority
-	config := cmdlineConfig.pullCmdLineConfig()
+	config, args, err := parse(o.Args, o.FlagSet)
 	cmdlineConfig.Configurations = config
+	cmdlineConfig.args = args
 
-	return cmdlineConfig
+	return cmdlineConfig, err
 }
 
-func (*Source) pullCmdLineConfig() map[string]interface{} {
+// parse returns key values and the arguments which are not flags
+func parse(arguments []string, fs *flag.FlagSet) (map[string]interface{}, []string, error) {
 	configMap := make(map[string]interface{})
-
-	for i, value := range os.Args {
-		if i == 0 {
+	args := make([]string, 0)
+	var parseErr error
+	for i := 0; i < len(arguments); i++ {
+		arg := arguments[i]
+		if arg == "--" {
+			args = append(args, arguments[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			args = append(args, arg)
+			continue
+		}
+		name := strings.TrimPrefix(arg[1:], "-")
+		if name == "" || name[0] == '-' || name[0] == '=' {
+			parseErr = firstErr(parseErr, fmt.Errorf("bad flag syntax: %s", arg))
 			continue
 		}
-		in := strings.Index(value, "=")
-		if (value[0] == '-') && (value[1] == ('-')) && (in >= 4) {
-			rs := []rune(value)
-			configMap[string(rs[2:in])] = string(rs[in+1:])
-		} else if (value[0] == '-') && (in == 2) {
-			rs := []rune(value)
-			configMap[string(rs[1:in])] = string(rs[in+1:])
+		if fs != nil && (name == "h" || name == "help") && fs.Lookup(name) == nil {
+			fs.Usage()
+			return configMap, args, flag.ErrHelp
+		}
+		value, hasValue := "", false
+		if in := strings.Index(name, "="); in >= 0 {
+			name, value, hasValue = name[:in], name[in+1:], true
+		}
+		var declared *flag.Flag
+		if fs != nil {
+			declared = fs.Lookup(name)
+		}
+		// a declared flag which is not boolean takes the next argument even if it looks like a flag, like "-1"
+		if !hasValue && i+1 < len(arguments) &&
+			(declared == nil && !isFlag(arguments[i+1]) || declared != nil && !isBoolFlag(declared)) {
+			i++
+			value, hasValue = arguments[i], true
+		}
+		if declared != nil {
+			if !hasValue {
+				if !isBoolFlag(declared) {
+					parseErr = firstErr(parseErr, fmt.Errorf("flag needs an argument: %s", arg))
+					continue
+				}
+				value = "true"
+			}
+			if err := fs.Set(name, value); err != nil {
+				parseErr = firstErr(parseErr, fmt.Errorf("invalid value %q for flag %s: %s", value, arg, err))
+			}
+			continue
 		}
+		if !hasValue {
+			addValue(configMap, name, true)
+			continue
+		}
+		addValue(configMap, name, value)
+	}
+	if fs != nil {
+		fs.VisitAll(func(f *flag.Flag) {
+			configMap[f.Name] = flagValue(f)
+		})
+	}
+	return configMap, args, parseErr
+}
+
+func firstErr(err, next error) error {
+	if err != nil {
+		return err
 	}
+	return next
+}
+
+// isFlag reports whether arg is a flag instead of the value of the flag before it
+func isFlag(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-'
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
 
-	return configMap
+// addValue sets the value of key, a key given more than once becomes a list
+func addValue(configMap map[string]interface{}, key string, value interface{}) {
+	old, ok := configMap[key]
+	if !ok {
+		configMap[key] = value
+		return
+	}
+	if list, ok := old.([]interface{}); ok {
+		configMap[key] = append(list, value)
+		return
+	}
+	configMap[key] = []interface{}{old, value}
+}
+
+// flagValue returns the typed value of flag, like int for flag.Int
+func flagValue(f *flag.Flag) interface{} {
+	if g, ok := f.Value.(flag.Getter); ok {
+		return g.Get()
+	}
+	return f.Value.String()
+}
+
+//Args returns the arguments which are not flags, including the ones after "--"
+func (cli *Source) Args() []string {
+	cli.RLock()
+	defer cli.RUnlock()
+	return cli.args
 }
 
 //GetConfigurations get configuration
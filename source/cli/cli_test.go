@@ -20,11 +20,15 @@
 package cli
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/go-chassis/go-archaius/event"
+	"github.com/stretchr/testify/assert"
 )
 
 type TestDynamicConfigHandler struct{}
@@ -101,3 +105,57 @@ func TestCommandLineConfigurationSource(t *testing.T) {
 		t.Error("commandlinesource cleanup is Failed")
 	}
 }
+
+func TestNewCommandlineSource(t *testing.T) {
+	t.Run("parse without flag set", func(t *testing.T) {
+		s, err := NewCommandlineSource(WithArgs([]string{"--a.b", "1", "--verbose", "-k=v", "-", "file",
+			"--tag=x", "--tag", "y", "--", "--not-a-flag"}))
+		assert.NoError(t, err)
+		configs, _ := s.GetConfigurations()
+		assert.Equal(t, map[string]interface{}{
+			"a.b":     "1",
+			"verbose": true,
+			"k":       "v",
+			"tag":     []interface{}{"x", "y"},
+		}, configs)
+		assert.Equal(t, []string{"-", "file", "--not-a-flag"}, s.Args())
+	})
+	t.Run("bind flag set", func(t *testing.T) {
+		fs := flag.NewFlagSet("app", flag.ContinueOnError)
+		fs.Int("port", 8080, "port to listen")
+		fs.Duration("timeout", time.Second, "timeout of requests")
+		fs.Bool("debug", false, "enable debug")
+		s, err := NewCommandlineSource(WithArgs([]string{"--port", "-1", "--debug", "file", "--name=demo"}),
+			WithFlagSet(fs))
+		assert.NoError(t, err)
+		configs, _ := s.GetConfigurations()
+		assert.Equal(t, map[string]interface{}{
+			"port":    -1,
+			"timeout": time.Second,
+			"debug":   true,
+			"name":    "demo",
+		}, configs)
+		assert.Equal(t, []string{"file"}, s.Args())
+	})
+	t.Run("errors", func(t *testing.T) {
+		fs := flag.NewFlagSet("app", flag.ContinueOnError)
+		fs.Int("port", 8080, "port to listen")
+		_, err := NewCommandlineSource(WithArgs([]string{"--port=abc"}), WithFlagSet(fs))
+		assert.Error(t, err)
+		_, err = NewCommandlineSource(WithArgs([]string{"--port"}), WithFlagSet(fs))
+		assert.Error(t, err)
+		_, err = NewCommandlineSource(WithArgs([]string{"---x"}))
+		assert.Error(t, err)
+		_, err = NewCommandlineSource(WithArgs([]string{"--=x"}))
+		assert.Error(t, err)
+	})
+	t.Run("help lists declared keys", func(t *testing.T) {
+		fs := flag.NewFlagSet("app", flag.ContinueOnError)
+		fs.Int("port", 8080, "port to listen")
+		buf := bytes.NewBuffer(nil)
+		fs.SetOutput(buf)
+		_, err := NewCommandlineSource(WithArgs([]string{"-h"}), WithFlagSet(fs))
+		assert.Equal(t, flag.ErrHelp, err)
+		assert.Contains(t, buf.String(), "port to listen")
+	})
+}
@@ -17,13 +17,14 @@
 package configmapource
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/go-chassis/go-archaius/event"
@@ -43,6 +44,8 @@ const (
 	configMapSourcePriority    = 4
 	//DefaultConfigMapPriority as default priority
 	DefaultConfigMapPriority = 0
+	// debounceWindow is the time a file must be quiet after a change before it is reloaded
+	debounceWindow = 50 * time.Millisecond
 )
 
 //ConfigMapFileSourceTypes is a string
@@ -65,23 +68,36 @@ type ConfigInfo struct {
 
 type configMapSource struct {
 	Configurations map[string]*ConfigInfo
-	files          []file
-	fileHandlers   map[string]util.FileHandler
-	watchPool      *watch
-	fileLock       sync.Mutex
-	priority       int
+	// roots are the files and directories added, files of directories are found by scanning them
+	roots []root
+	// files are the visible files of roots, fileConfigs holds the key values of each file
+	files       []file
+	fileConfigs map[string]map[string]interface{}
+	// contentHashes holds the hash of content loaded from each file
+	contentHashes map[string][sha256.Size]byte
+	watchPool     *watch
+	fileLock      sync.Mutex
+	priority      int
 	sync.RWMutex
 }
 
+type root struct {
+	path     string
+	priority uint32
+	handler  util.FileHandler
+}
+
 type file struct {
 	filePath string
 	priority uint32
+	handler  util.FileHandler
 }
 
 type watch struct {
 	watcher         *fsnotify.Watcher
 	callback        source.EventHandler
 	configMapSource *configMapSource
+	debouncer       *util.Debouncer
 	sync.RWMutex
 }
 
@@ -98,13 +114,14 @@ func NewConfigMapSource() ConfigMapSource {
 	if configMapConfigSource == nil {
 		configMapConfigSource = new(configMapSource)
 		configMapConfigSource.priority = configMapSourcePriority
-		configMapConfigSource.files = make([]file, 0)
-		configMapConfigSource.fileHandlers = make(map[string]util.FileHandler)
 	}
 
 	return configMapConfigSource
 }
 
+//AddFile adds a file or a directory of mounted config map, files of sub directories are included.
+//hidden entries like "..data" of kubernetes are skipped, files are read through their symlinks instead.
+//if key conflicts, the file with higher priority (lower value) wins
 func (cmSource *configMapSource) AddFile(p string, priority uint32, handle util.FileHandler) error {
 
 	path, err := cmSource.getFilePath(p)
@@ -112,51 +129,17 @@ func (cmSource *configMapSource) AddFile(p string, priority uint32, handle util.
 		return err
 	}
 
-	if cmSource.isFileSrcExist(path) {
-		return nil
-	}
-	cmSource.fileHandlers[path] = handle
-
-	err = filepath.Walk(p,
-		func(p string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			path, err = filepath.Abs(p)
-			if err != nil {
-				return err
-			}
-
-			fs, err := os.Open(path)
-			if os.IsNotExist(err) {
-				return fmt.Errorf("[%s] file not exist", path)
-			}
-			defer fs.Close()
-
-			getFileType := getFileType(fs)
-			switch getFileType {
-			case Directory:
-				if cmSource.watchPool != nil {
-					cmSource.watchPool.AddWatchFile(path)
-				}
-			case RegularFile:
-				err := cmSource.handleFile(fs, priority, handle)
-				if cmSource.watchPool != nil {
-					cmSource.watchPool.AddWatchFile(path)
-				}
-				if err != nil {
-					openlog.Error(fmt.Sprintf("Failed to handle file [%s] [%s]", path, err))
-					return err
-				}
-			case InvalidFileType:
-				openlog.Error(fmt.Sprintf("File type of [%s] not supported: %s", path, err))
-				return fmt.Errorf("file type of [%s] not supported", path)
-			}
-
+	cmSource.Lock()
+	for _, r := range cmSource.roots {
+		if r.path == path {
+			cmSource.Unlock()
 			return nil
-		})
+		}
+	}
+	cmSource.roots = append(cmSource.roots, root{path: path, priority: priority, handler: handle})
+	cmSource.Unlock()
 
-	return nil
+	return cmSource.sync(cmSource.callback())
 }
 
 func (cmSource *configMapSource) getFilePath(filePath string) (string, error) {
@@ -173,104 +156,232 @@ func (cmSource *configMapSource) getFilePath(filePath string) (string, error) {
 	return path, nil
 }
 
-func (cmSource *configMapSource) isFileSrcExist(filePath string) bool {
-	var exist bool
-	for _, file := range cmSource.files {
-		if filePath == file.filePath {
-			return true
-		}
+// callback returns the handler given by Watch, or nil if source is not watched yet
+func (cmSource *configMapSource) callback() source.EventHandler {
+	cmSource.RLock()
+	defer cmSource.RUnlock()
+	if cmSource.watchPool == nil {
+		return nil
 	}
+	return cmSource.watchPool.callback
+}
 
-	return exist
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~")
 }
 
-func getFileType(fs *os.File) ConfigMapFileSourceTypes {
-	fileInfo, err := fs.Stat()
+// scan returns the visible files of root and the directories to watch.
+// a file is watched by its directory, so that a swap of "..data" symlink is noticed
+func (r root) scan() ([]file, []string, error) {
+	info, err := os.Stat(r.path)
+	if os.IsNotExist(err) {
+		// keys of root are deleted, they come back once it is created again
+		return nil, []string{filepath.Dir(r.path)}, nil
+	}
 	if err != nil {
-		return InvalidFileType
+		return nil, nil, err
 	}
-
-	fileMode := fileInfo.Mode()
-
-	if fileMode.IsDir() {
-		return Directory
-	} else if fileMode.IsRegular() {
-		return RegularFile
+	if !info.IsDir() {
+		return []file{{filePath: r.path, priority: r.priority, handler: r.handler}}, []string{filepath.Dir(r.path)}, nil
 	}
 
-	return InvalidFileType
+	files := make([]file, 0)
+	dirs := make([]string, 0)
+	// real paths of the directories walked, a symlink back to one of them is not followed again
+	walked := make(map[string]bool)
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		if walked[real] {
+			return nil
+		}
+		walked[real] = true
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, dir)
+		for _, info := range infos {
+			if isHidden(info.Name()) {
+				continue
+			}
+			p := filepath.Join(dir, info.Name())
+			if info.Mode()&os.ModeSymlink != 0 {
+				// symlinks are followed, like "conf -> ..data/conf" of a config map item with sub path
+				target, err := os.Stat(p)
+				if err != nil {
+					continue
+				}
+				info = target
+			}
+			if info.IsDir() {
+				// files removed while walking are skipped
+				walk(p)
+				continue
+			}
+			if info.Mode().IsRegular() {
+				files = append(files, file{filePath: p, priority: r.priority, handler: r.handler})
+			}
+		}
+		return nil
+	}
+	err = walk(r.path)
+	return files, dirs, err
 }
 
-func (cmSource *configMapSource) handleFile(file *os.File, priority uint32, handle util.FileHandler) error {
-	Content, err := ioutil.ReadFile(file.Name())
-	if err != nil {
-		return err
-	}
-	var config map[string]interface{}
-	if handle != nil {
-		config, err = handle(file.Name(), Content)
-	} else {
-		config, err = util.Convert2JavaProps(file.Name(), Content)
-	}
-	if err != nil {
-		return fmt.Errorf("failed to pull configurations from [%s] file, %s", file.Name(), err)
-	}
+// sync scans roots and loads their visible files again, the changes of all files are fired as one batch,
+// so that a rotation of "..data" symlink causes one diff. a file failing to load keeps its last good key values,
+// and the changes are published only if they are accepted
+func (cmSource *configMapSource) sync(callback source.EventHandler) error {
+	cmSource.fileLock.Lock()
+	defer cmSource.fileLock.Unlock()
 
-	err = cmSource.handlePriority(file.Name(), priority)
-	if err != nil {
-		return fmt.Errorf("failed to handle priority of [%s], %s", file.Name(), err)
+	cmSource.RLock()
+	roots := make([]root, len(cmSource.roots))
+	copy(roots, cmSource.roots)
+	oldConfigs, oldHashes := cmSource.fileConfigs, cmSource.contentHashes
+	cmSource.RUnlock()
+
+	files := make([]file, 0)
+	dirs := make([]string, 0)
+	found := make(map[string]bool)
+	for _, r := range roots {
+		rootFiles, rootDirs, err := r.scan()
+		if err != nil {
+			openlog.Error(fmt.Sprintf("failed to scan [%s]: %s", r.path, err))
+			continue
+		}
+		for _, f := range rootFiles {
+			if !found[f.filePath] {
+				found[f.filePath] = true
+				files = append(files, f)
+			}
+		}
+		dirs = append(dirs, rootDirs...)
 	}
 
-	events := cmSource.compareUpdate(config, file.Name())
-	if cmSource.watchPool != nil && cmSource.watchPool.callback != nil { // if file source already added and try to add
-		for _, e := range events {
-			cmSource.watchPool.callback.OnEvent(e)
+	fileConfigs := make(map[string]map[string]interface{}, len(files))
+	hashes := make(map[string][sha256.Size]byte, len(files))
+	for _, f := range files {
+		old, loaded := oldConfigs[f.filePath]
+		content, err := ioutil.ReadFile(f.filePath)
+		if err != nil {
+			openlog.Error("read file error " + err.Error())
+			if loaded {
+				fileConfigs[f.filePath], hashes[f.filePath] = old, oldHashes[f.filePath]
+			}
+			continue
+		}
+		hash := sha256.Sum256(content)
+		if loaded && oldHashes[f.filePath] == hash {
+			fileConfigs[f.filePath], hashes[f.filePath] = old, hash
+			continue
 		}
+		handle := f.handler
+		if handle == nil {
+			handle = util.GetFileHandler(f.filePath)
+		}
+		config, err := handle(f.filePath, content)
+		if err != nil {
+			openlog.Error(fmt.Sprintf("convert [%s] error %s, keep last good configurations", f.filePath, err))
+			if loaded {
+				fileConfigs[f.filePath], hashes[f.filePath] = old, oldHashes[f.filePath]
+			}
+			continue
+		}
+		fileConfigs[f.filePath], hashes[f.filePath] = config, hash
 	}
 
+	merged := merge(files, fileConfigs)
+	cmSource.RLock()
+	backupConfigurations, backupFiles := cmSource.Configurations, cmSource.files
+	events := diff(cmSource.Configurations, merged)
+	watchPool := cmSource.watchPool
+	cmSource.RUnlock()
+
+	if watchPool != nil {
+		for _, dir := range dirs {
+			watchPool.AddWatchFile(dir)
+		}
+	}
+	commit := func() {
+		cmSource.Lock()
+		cmSource.Configurations = merged
+		cmSource.files = files
+		cmSource.fileConfigs = fileConfigs
+		cmSource.contentHashes = hashes
+		cmSource.Unlock()
+	}
+	if callback == nil || len(events) == 0 {
+		commit()
+		return nil
+	}
+	rollback := func() {
+		cmSource.Lock()
+		cmSource.Configurations, cmSource.files = backupConfigurations, backupFiles
+		cmSource.fileConfigs, cmSource.contentHashes = oldConfigs, oldHashes
+		cmSource.Unlock()
+	}
+	if err := source.CommitModuleEvent(callback, events, commit, rollback); err != nil {
+		return fmt.Errorf("changes of config map rejected: %s", err)
+	}
 	return nil
 }
 
-func (cmSource *configMapSource) handlePriority(filePath string, priority uint32) error {
-	cmSource.Lock()
-	newFilePriority := make([]file, 0)
-	var prioritySet bool
-	for _, f := range cmSource.files {
-
-		if f.filePath == filePath && f.priority == priority {
-			prioritySet = true
-			newFilePriority = append(newFilePriority, file{
-				filePath: filePath,
-				priority: priority,
-			})
+// merge resolves the conflicts between files, a key takes the value of the file with highest priority (lowest value),
+// if priorities are the same, the file found later wins
+func merge(files []file, fileConfigs map[string]map[string]interface{}) map[string]*ConfigInfo {
+	merged := make(map[string]*ConfigInfo)
+	winners := make(map[string]uint32)
+	for _, f := range files {
+		for key, value := range fileConfigs[f.filePath] {
+			if priority, ok := winners[key]; ok && priority < f.priority {
+				continue
+			}
+			winners[key] = f.priority
+			merged[key] = &ConfigInfo{FilePath: f.filePath, Value: value}
 		}
-		newFilePriority = append(newFilePriority, f)
 	}
+	return merged
+}
 
-	if !prioritySet {
-		newFilePriority = append(newFilePriority, file{
-			filePath: filePath,
-			priority: priority,
-		})
+// diff returns the events which change old configurations into new ones, sorted by key
+func diff(old, new map[string]*ConfigInfo) []*event.Event {
+	events := make([]*event.Event, 0)
+	for key, confInfo := range old {
+		newConfInfo, ok := new[key]
+		if !ok {
+			events = append(events, &event.Event{EventSource: ConfigMapConfigSourceConst, Key: key,
+				EventType: event.Delete, Value: confInfo.Value})
+			continue
+		}
+		if !reflect.DeepEqual(confInfo.Value, newConfInfo.Value) {
+			events = append(events, &event.Event{EventSource: ConfigMapConfigSourceConst, Key: key,
+				EventType: event.Update, Value: newConfInfo.Value})
+		}
 	}
-
-	cmSource.files = newFilePriority
-	cmSource.Unlock()
-
-	return nil
+	for key, confInfo := range new {
+		if _, ok := old[key]; ok {
+			continue
+		}
+		events = append(events, &event.Event{EventSource: ConfigMapConfigSourceConst, Key: key,
+			EventType: event.Create, Value: confInfo.Value})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
 }
 
 func (cmSource *configMapSource) GetConfigurations() (map[string]interface{}, error) {
 	configMap := make(map[string]interface{})
 
-	cmSource.Lock()
-	defer cmSource.Unlock()
+	cmSource.RLock()
+	defer cmSource.RUnlock()
 	for key, confInfo := range cmSource.Configurations {
-		if confInfo == nil {
-			configMap[key] = nil
-			continue
-		}
-
 		configMap[key] = confInfo.Value
 	}
 
@@ -281,18 +392,11 @@ func (cmSource *configMapSource) GetConfigurationByKey(key string) (interface{},
 	cmSource.RLock()
 	defer cmSource.RUnlock()
 
-	for ckey, confInfo := range cmSource.Configurations {
-		if confInfo == nil {
-			confInfo.Value = nil
-			continue
-		}
-
-		if ckey == key {
-			return confInfo.Value, nil
-		}
+	confInfo, ok := cmSource.Configurations[key]
+	if !ok {
+		return nil, source.ErrKeyNotExist
 	}
-
-	return nil, source.ErrKeyNotExist
+	return confInfo.Value, nil
 }
 
 func (*configMapSource) GetSourceName() string {
@@ -308,6 +412,13 @@ func (cmSource *configMapSource) SetPriority(priority int) {
 	cmSource.priority = priority
 }
 
+//Reload scans and loads all files again, and applies the changes to handler
+func (cmSource *configMapSource) Reload(handler source.EventHandler) error {
+	return cmSource.sync(handler)
+}
+
+//Watch watches the directories of files, a change of them loads all files again,
+//changes made before watching are loaded too
 func (cmSource *configMapSource) Watch(callback source.EventHandler) error {
 	if callback == nil {
 		return errors.New("call back can not be nil")
@@ -318,11 +429,13 @@ func (cmSource *configMapSource) Watch(callback source.EventHandler) error {
 		return err
 	}
 
+	cmSource.Lock()
 	cmSource.watchPool = watchPool
+	cmSource.Unlock()
 
-	go cmSource.watchPool.startWatchPool()
+	go watchPool.watchFile()
 
-	return nil
+	return cmSource.sync(callback)
 }
 
 func newWatchPool(callback source.EventHandler, cfgSrc *configMapSource) (*watch, error) {
@@ -336,27 +449,11 @@ func newWatchPool(callback source.EventHandler, cfgSrc *configMapSource) (*watch
 	watch.callback = callback
 	watch.configMapSource = cfgSrc
 	watch.watcher = watcher
+	watch.debouncer = util.NewDebouncer()
 	openlog.Info("create new watcher")
 	return watch, nil
 }
 
-func (wth *watch) startWatchPool() {
-	go wth.watchFile()
-	for _, file := range wth.configMapSource.files {
-		f, err := filepath.Abs(file.filePath)
-		if err != nil {
-			openlog.Error(fmt.Sprintf("failed to get Directory info from: %s file: %s", file.filePath, err))
-			return
-		}
-
-		err = wth.watcher.Add(f)
-		if err != nil {
-			openlog.Error(fmt.Sprintf("add watcher file: %+v fail %s", file, err))
-			return
-		}
-	}
-}
-
 func (wth *watch) AddWatchFile(filePath string) {
 	err := wth.watcher.Add(filePath)
 	if err != nil {
@@ -373,186 +470,24 @@ func (wth *watch) watchFile() {
 				openlog.Warn("file watcher stop")
 				return
 			}
+			openlog.Debug(fmt.Sprintf("file event %s, operation is %d", event.Name, event.Op))
 
-			if strings.HasSuffix(event.Name, ".swx") || strings.HasSuffix(event.Name, ".swp") || strings.HasSuffix(event.Name, "~") {
-				//ignore
-				continue
-			}
-
-			if event.Op == fsnotify.Remove {
-				openlog.Warn(fmt.Sprintf("the file change mode: %s, continue", event.String()))
-				continue
-			}
-
-			if event.Op == fsnotify.Rename {
-				wth.watcher.Remove(event.Name)
-				// check existence of file
-				_, err := os.Open(event.Name)
-				if os.IsNotExist(err) {
-					openlog.Warn(fmt.Sprintf("[%s] file does not exist so not able to watch further: %s", event.Name, err))
-				} else {
-					wth.AddWatchFile(event.Name)
+			// events of hidden entries are not ignored, they may be a rotation of "..data" symlink.
+			// the events of one save or rotation are merged, files are read once they are written completely
+			wth.debouncer.Debounce(ConfigMapConfigSourceConst, debounceWindow, func() {
+				if err := wth.configMapSource.sync(wth.callback); err != nil {
+					openlog.Error(err.Error())
 				}
+			})
 
-				continue
-			}
-
-			if event.Op == fsnotify.Create {
-				time.Sleep(time.Millisecond)
-			}
-
-			wth.configMapSource.updateFile(wth, event)
-
-		case err := <-wth.watcher.Errors:
-			openlog.Debug(fmt.Sprintf("watch file error: %s", err))
-			return
-		}
-	}
-}
-
-func (cmSource *configMapSource) updateFile(wth *watch, event fsnotify.Event) {
-	if wth.configMapSource.isFileSrcExist(event.Name) {
-		handle := wth.configMapSource.fileHandlers[event.Name]
-		if handle == nil {
-			handle = util.Convert2JavaProps
-		}
-		content, err := ioutil.ReadFile(event.Name)
-		if err != nil {
-			openlog.Error("read file error " + err.Error())
-			return
-		}
-
-		newConf, err := handle(event.Name, content)
-		if err != nil {
-			openlog.Error("convert error " + err.Error())
-			return
-		}
-		events := wth.configMapSource.compareUpdate(newConf, event.Name)
-		for _, e := range events {
-			wth.callback.OnEvent(e)
-		}
-	} else {
-		var priority uint32 = configMapSourcePriority
-		for _, file := range wth.configMapSource.files {
-			if strings.Contains(event.Name, file.filePath) {
-				priority = file.priority
-			}
-		}
-
-		var fileHandler util.FileHandler
-		for path, handler := range wth.configMapSource.fileHandlers {
-			if strings.Contains(event.Name, path) {
-				fileHandler = handler
-			}
-		}
-		wth.configMapSource.AddFile(event.Name, priority, fileHandler)
-	}
-
-}
-
-func (cmSource *configMapSource) compareUpdate(newconf map[string]interface{}, filePath string) []*event.Event {
-	events := make([]*event.Event, 0)
-	fileConfs := make(map[string]*ConfigInfo)
-	if cmSource == nil {
-		return nil
-	}
-
-	cmSource.Lock()
-	defer cmSource.Unlock()
-
-	var filePathPriority uint32 = math.MaxUint32
-	for _, file := range cmSource.files {
-		if file.filePath == filePath {
-			filePathPriority = file.priority
-		}
-	}
-
-	if filePathPriority == math.MaxUint32 {
-		return nil
-	}
-
-	for key, confInfo := range cmSource.Configurations {
-		if confInfo == nil {
-			confInfo.Value = nil
-			continue
-		}
-
-		switch confInfo.FilePath {
-		case filePath:
-			newConfValue, ok := newconf[key]
+		case err, ok := <-wth.watcher.Errors:
 			if !ok {
-				events = append(events, &event.Event{EventSource: ConfigMapConfigSourceConst, Key: key,
-					EventType: event.Delete, Value: confInfo.Value})
-				continue
-			} else if reflect.DeepEqual(confInfo.Value, newConfValue) {
-				fileConfs[key] = confInfo
-				continue
-			}
-
-			confInfo.Value = newConfValue
-			fileConfs[key] = confInfo
-
-			events = append(events, &event.Event{EventSource: ConfigMapConfigSourceConst, Key: key,
-				EventType: event.Update, Value: newConfValue})
-
-		default:
-			newConfValue, ok := newconf[key]
-			if ok {
-				var priority uint32 = math.MaxUint32
-				for _, file := range cmSource.files {
-					if file.filePath == confInfo.FilePath {
-						priority = file.priority
-					}
-				}
-
-				if priority == filePathPriority {
-					fileConfs[key] = confInfo
-					confInfo.Value = newconf[key]
-					//openlog.Infof("Two files have same priority. use new value: %s ", confInfo.FilePath)
-
-				} else if filePathPriority < priority { // lower the vale higher is the priority
-					confInfo.Value = newConfValue
-					fileConfs[key] = confInfo
-					events = append(events, &event.Event{EventSource: ConfigMapConfigSourceConst,
-						Key: key, EventType: event.Update, Value: newConfValue})
-
-				} else {
-					fileConfs[key] = confInfo
-				}
-			} else {
-				fileConfs[key] = confInfo
-			}
-		}
-	}
-
-	fileConfs, events = cmSource.addOrCreateConf(fileConfs, newconf, events, filePath)
-
-	cmSource.Configurations = fileConfs
-
-	return events
-}
-
-func (cmSource *configMapSource) addOrCreateConf(fileConfs map[string]*ConfigInfo, newconf map[string]interface{},
-	events []*event.Event, filePath string) (map[string]*ConfigInfo, []*event.Event) {
-	for key, value := range newconf {
-		handled := false
-
-		_, ok := fileConfs[key]
-		if ok {
-			handled = true
-		}
-
-		if !handled {
-			events = append(events, &event.Event{EventSource: ConfigMapConfigSourceConst, Key: key,
-				EventType: event.Create, Value: value})
-			fileConfs[key] = &ConfigInfo{
-				FilePath: filePath,
-				Value:    value,
+				openlog.Warn("file watcher stop")
+				return
 			}
+			openlog.Debug(fmt.Sprintf("watch file error: %s", err))
 		}
 	}
-
-	return fileConfs, events
 }
 
 func (cmSource *configMapSource) Cleanup() error {
@@ -564,17 +499,21 @@ func (cmSource *configMapSource) Cleanup() error {
 		return nil
 	}
 
+	cmSource.Lock()
+	defer cmSource.Unlock()
 	if cmSource.watchPool != nil && cmSource.watchPool.watcher != nil {
 		cmSource.watchPool.watcher.Close()
 	}
 
 	if cmSource.watchPool != nil {
-		cmSource.watchPool.configMapSource = nil
-		cmSource.watchPool.callback = nil
+		cmSource.watchPool.debouncer.Stop()
 		cmSource.watchPool = nil
 	}
 	cmSource.Configurations = nil
-	cmSource.files = make([]file, 0)
+	cmSource.roots = nil
+	cmSource.files = nil
+	cmSource.fileConfigs = nil
+	cmSource.contentHashes = nil
 	return nil
 }
 
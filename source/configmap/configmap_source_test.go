@@ -19,8 +19,10 @@ package configmapource
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -137,7 +139,7 @@ func TestDynamicConfigurations(t *testing.T) {
 	yamlContent1 = "\nyamlkeytest13: test13\n"
 	_, err = io.WriteString(f1, yamlContent1)
 	check(err)
-	time.Sleep(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
 
 	t.Log("Verifying the key of highest priority file(filename1)")
 	configkey, err := cmSource.GetConfigurationByKey("yamlkeytest13")
@@ -161,7 +163,7 @@ func TestDynamicConfigurations(t *testing.T) {
 	yamlContent1 = "\nyamlkeytest123: test12311\n"
 	_, err = io.WriteString(f1, yamlContent1)
 	check(err)
-	time.Sleep(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
 
 	//Verifying the of highest priority file(filename1)
 	configkey, err = cmSource.GetConfigurationByKey("yamlkeytest123")
@@ -173,7 +175,7 @@ func TestDynamicConfigurations(t *testing.T) {
 	yamlContent3 = "\nyamlkeytest123: test12333\n"
 	_, err = io.WriteString(f3, yamlContent3)
 	check(err)
-	time.Sleep(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
 
 	t.Log("verifying the key of lowest priority file(filename3)")
 	configkey, err = cmSource.GetConfigurationByKey("yamlkeytest123")
@@ -184,7 +186,7 @@ func TestDynamicConfigurations(t *testing.T) {
 	t.Log("adding new files after dynhandler is inited")
 	cmSource.AddFile(filename4, 3, nil)
 	cmSource.AddFile(filename5, 4, nil)
-	time.Sleep(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
 
 	t.Log("verifying the configurations of newely added files")
 	configkey, err = cmSource.GetConfigurationByKey("yamlkeytest41")
@@ -196,7 +198,7 @@ func TestDynamicConfigurations(t *testing.T) {
 	yamlContent4 = "\nyamlkeytest45: test454\n"
 	_, err = io.WriteString(f4, yamlContent4)
 	check(err)
-	time.Sleep(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
 	configkey, _ = cmSource.GetConfigurationByKey("yamlkeytest45")
 	assert.Equal(t, "test454", configkey)
 
@@ -204,7 +206,7 @@ func TestDynamicConfigurations(t *testing.T) {
 	yamlContent5 = "\nyamlkeytest45: test455\n"
 	_, err = io.WriteString(f5, yamlContent5)
 	check(err)
-	time.Sleep(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
 	configkey, _ = cmSource.GetConfigurationByKey("yamlkeytest45")
 	t.Log("verifying the event from lowest priority file(filename5)")
 	assert.NotEqual(t, "test455", configkey)
@@ -341,3 +343,80 @@ func TestConfigMapSource2(t *testing.T) {
 	}
 
 }
+
+type batchHandler struct {
+	mu      sync.Mutex
+	batches [][]*event.Event
+}
+
+func (h *batchHandler) OnEvent(e *event.Event) {}
+
+func (h *batchHandler) OnModuleEvent(events []*event.Event) {
+	h.mu.Lock()
+	h.batches = append(h.batches, events)
+	h.mu.Unlock()
+}
+
+func (h *batchHandler) received() [][]*event.Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.batches
+}
+
+// TestDataRotation updates config map the way kubernetes does,
+// files are symlinks to "..data", which is swapped to a new timestamped directory atomically
+func TestDataRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configmap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeVersion := func(version string, files map[string]string) {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, version), 0700))
+		for name, content := range files {
+			assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, version, name)), 0700))
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, version, name), []byte(content), 0600))
+		}
+		assert.NoError(t, os.Symlink(version, filepath.Join(dir, "..data_tmp")))
+		assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	}
+	writeVersion("..v1", map[string]string{
+		"app.yaml":      "app:\n  name: demo\n  timeout: 1\n",
+		"feature.yaml":  "feature:\n  enabled: true\n",
+		"conf/sub.yaml": "sub:\n  size: 1\n",
+	})
+	// an item with sub path is a symlink to a directory, a symlink back to it is not followed again
+	assert.NoError(t, os.Symlink(".", filepath.Join(dir, "..v1", "conf", "self")))
+	for _, name := range []string{"app.yaml", "feature.yaml", "conf"} {
+		assert.NoError(t, os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name)))
+	}
+
+	cmSource := NewConfigMapSource()
+	defer cmSource.Cleanup()
+	assert.NoError(t, cmSource.AddFile(dir, DefaultConfigMapPriority, nil))
+	configs, err := cmSource.GetConfigurations()
+	assert.NoError(t, err)
+	// files of hidden "..v1" directory are not loaded twice
+	assert.Equal(t, map[string]interface{}{"app.name": "demo", "app.timeout": 1, "feature.enabled": true,
+		"sub.size": 1}, configs)
+
+	h := &batchHandler{}
+	assert.NoError(t, cmSource.Watch(h))
+	// feature.yaml is removed from config map, its symlink is left dangling until kubelet removes it
+	writeVersion("..v2", map[string]string{
+		"app.yaml":      "app:\n  name: demo\n  timeout: 2\n",
+		"conf/sub.yaml": "sub:\n  size: 2\n",
+	})
+	assert.Eventually(t, func() bool { return len(h.received()) > 0 }, 3*time.Second, 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+
+	batches := h.received()
+	assert.Equal(t, 1, len(batches))
+	assert.Equal(t, 3, len(batches[0]))
+	assert.Equal(t, "app.timeout", batches[0][0].Key)
+	assert.Equal(t, event.Update, batches[0][0].EventType)
+	assert.Equal(t, "feature.enabled", batches[0][1].Key)
+	assert.Equal(t, event.Delete, batches[0][1].EventType)
+	assert.Equal(t, "sub.size", batches[0][2].Key)
+	assert.Equal(t, event.Update, batches[0][2].EventType)
+	_, err = cmSource.GetConfigurationByKey("feature.enabled")
+	assert.Error(t, err)
+}
@@ -18,10 +18,12 @@
 package env
 
 import (
+	"fmt"
 	"os"
 	"strings"
 	"sync"
 
+	"github.com/go-chassis/go-archaius/event"
 	"github.com/go-chassis/go-archaius/source"
 
 	"github.com/go-chassis/openlog"
@@ -32,33 +34,167 @@ const (
 	envVariableSourcePriority = 3
 )
 
+//Options is options of env source
+type Options struct {
+	// Prefix makes only variables with prefix imported, prefix is stripped from keys, like "MYAPP_"
+	Prefix string
+	// NestingSeparator separates levels of keys, like "__" for "DB__MAX_IDLE" to "DB.MAX_IDLE",
+	// every "_" separates levels if it is empty
+	NestingSeparator string
+	// Lowercase lowercases keys, like "db.max_idle" for "DB__MAX_IDLE"
+	Lowercase bool
+	// Bindings maps keys to names of variables, they are imported without prefix and mapping
+	Bindings map[string]string
+}
+
+//Option is a func
+type Option func(options *Options)
+
+//WithPrefix imports only variables with prefix, and strips prefix from keys
+func WithPrefix(prefix string) Option {
+	return func(options *Options) {
+		options.Prefix = prefix
+	}
+}
+
+//WithNestingSeparator separates levels of keys by separator instead of every "_"
+func WithNestingSeparator(separator string) Option {
+	return func(options *Options) {
+		options.NestingSeparator = separator
+	}
+}
+
+//WithLowercase lowercases keys
+func WithLowercase() Option {
+	return func(options *Options) {
+		options.Lowercase = true
+	}
+}
+
+//BindEnv imports variable envName as key, like BindEnv("db.password", "DB_PASS").
+//the variable is not imported by its mapped name any more
+func BindEnv(key, envName string) Option {
+	return func(options *Options) {
+		if options.Bindings == nil {
+			options.Bindings = make(map[string]string)
+		}
+		options.Bindings[key] = envName
+	}
+}
+
 //Source is a struct
 type Source struct {
 	Configs  sync.Map
 	priority int
+	opts     Options
+	// reloadMux makes reloads one by one
+	reloadMux sync.Mutex
 }
 
-//NewEnvConfigurationSource configures a new environment configuration
-func NewEnvConfigurationSource() source.ConfigSource {
+//NewEnvConfigurationSource configures a new environment configuration.
+//without options, all variables are imported and "_" of names are replaced by "."
+func NewEnvConfigurationSource(opts ...Option) source.ConfigSource {
 	openlog.Info("enable env source")
 	envConfigSource := new(Source)
 	envConfigSource.priority = envVariableSourcePriority
+	for _, opt := range opts {
+		opt(&envConfigSource.opts)
+	}
 	envConfigSource.pullConfigurations()
 	return envConfigSource
 }
 
 func (es *Source) pullConfigurations() {
 	es.Configs = sync.Map{}
+	for key, value := range es.readConfigurations() {
+		es.Configs.Store(key, value)
+	}
+}
+
+// readConfigurations returns the key values of environment variables
+func (es *Source) readConfigurations() map[string]interface{} {
+	configs := make(map[string]interface{})
+	bound := make(map[string]bool, len(es.opts.Bindings))
+	for key, name := range es.opts.Bindings {
+		bound[name] = true
+		if value, ok := os.LookupEnv(name); ok {
+			configs[key] = value
+		}
+	}
 	for _, value := range os.Environ() {
-		rs := []rune(value)
 		in := strings.Index(value, "=")
-		key := string(rs[0:in])
-		value := string(rs[in+1:])
-		envKey := strings.Replace(key, "_", ".", -1)
+		name := value[0:in]
+		if bound[name] {
+			continue
+		}
+		key, ok := es.keyOf(name)
+		if !ok {
+			continue
+		}
+		if _, ok := configs[key]; ok {
+			// bindings win over mapped names
+			continue
+		}
+		configs[key] = value[in+1:]
+	}
+	return configs
+}
+
+// store replaces key values of source with configs
+func (es *Source) store(configs map[string]interface{}) {
+	es.Configs.Range(func(k, v interface{}) bool {
+		if _, ok := configs[k.(string)]; !ok {
+			es.Configs.Delete(k)
+		}
+		return true
+	})
+	for key, value := range configs {
 		es.Configs.Store(key, value)
-		es.Configs.Store(envKey, value)
+	}
+}
 
+//Reload reads environment variables again, like after an environment file is reloaded,
+//the changes are applied to handler, and they are published only if they are accepted
+func (es *Source) Reload(handler source.EventHandler) error {
+	es.reloadMux.Lock()
+	defer es.reloadMux.Unlock()
+	old, err := es.GetConfigurations()
+	if err != nil {
+		return err
+	}
+	configs := es.readConfigurations()
+	events, err := event.PopulateEvents(envSourceConst, old, configs)
+	if err != nil {
+		return err
+	}
+	commit := func() {
+		es.store(configs)
+	}
+	if handler == nil || len(events) == 0 {
+		commit()
+		return nil
+	}
+	if err := source.CommitModuleEvent(handler, events, commit, func() { es.store(old) }); err != nil {
+		return fmt.Errorf("changes of environment rejected: %s", err)
+	}
+	return nil
+}
+
+// keyOf maps name of variable to key, it returns false if variable is not imported
+func (es *Source) keyOf(name string) (string, bool) {
+	if !strings.HasPrefix(name, es.opts.Prefix) || name == es.opts.Prefix {
+		return "", false
+	}
+	key := strings.TrimPrefix(name, es.opts.Prefix)
+	if es.opts.NestingSeparator != "" {
+		key = strings.Replace(key, es.opts.NestingSeparator, ".", -1)
+	} else {
+		key = strings.Replace(key, "_", ".", -1)
+	}
+	if es.opts.Lowercase {
+		key = strings.ToLower(key)
 	}
+	return key, true
 }
 
 //GetConfigurations gets all configuration
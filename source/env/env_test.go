@@ -55,9 +55,22 @@ func TestEnvConfigurationSource(t *testing.T) {
 		v, err := envsource.GetConfigurationByKey("a.b.c.d")
 		assert.Equal(t, nil, err)
 		assert.Equal(t, "asd", v)
-		v, err = envsource.GetConfigurationByKey("a_b_c_d")
-		assert.Equal(t, nil, err)
-		assert.Equal(t, "asd", v)
+		_, err = envsource.GetConfigurationByKey("a_b_c_d")
+		assert.Error(t, err)
+	})
+	t.Run("prefix, nesting separator, lowercase and bindings", func(t *testing.T) {
+		os.Setenv("MYAPP_DB__MAX_IDLE", "10")
+		os.Setenv("MYAPP_DB__HOST", "localhost")
+		os.Setenv("DB_PASS", "s3cret")
+		envsource := env.NewEnvConfigurationSource(env.WithPrefix("MYAPP_"), env.WithNestingSeparator("__"),
+			env.WithLowercase(), env.BindEnv("db.password", "DB_PASS"), env.BindEnv("db.host", "MYAPP_DB__HOST"))
+		configs, err := envsource.GetConfigurations()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"db.max_idle": "10",
+			"db.host":     "localhost",
+			"db.password": "s3cret",
+		}, configs)
 	})
 	t.Log("Test envconfigurationsource.go")
 
@@ -18,14 +18,14 @@
 package filesource
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math"
 	"os"
 	"path/filepath"
 	"reflect"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 
@@ -42,6 +42,10 @@ const (
 	fileSourcePriority    = 4
 	//DefaultFilePriority is a variable of type string
 	DefaultFilePriority = 0
+	// deleteGracePeriod is the time to wait for a removed or renamed file to be created again
+	deleteGracePeriod = 100 * time.Millisecond
+	//DefaultDebounceWindow is the time a file must be quiet after a change before it is reloaded
+	DefaultDebounceWindow = 50 * time.Millisecond
 )
 
 //FileSourceTypes is a string
@@ -64,12 +68,30 @@ type ConfigInfo struct {
 
 //Source is file source
 type Source struct {
+	// Configurations holds the merged key values, each of them comes from the file which wins the conflict
 	Configurations map[string]*ConfigInfo
-	files          []file
-	fileHandlers   map[string]util.FileHandler
-	watchPool      *watch
-	filelock       sync.Mutex
-	priority       int
+	// fileConfigs holds the key values of each file
+	fileConfigs  map[string]map[string]interface{}
+	files        []file
+	patterns     []*pattern
+	fileHandlers map[string]util.FileHandler
+	// pollIntervals holds the polling interval of files, polling maps polled path to the channel stopping it
+	pollIntervals map[string]time.Duration
+	polling       map[string]chan struct{}
+	pollDone      chan struct{}
+	// fileErrors holds the latest error of files which fail to load, they keep the last good configurations
+	fileErrors map[string]*event.SourceError
+	// debounceWindows holds the debounce window of files, contentHashes holds the hash of the loaded content
+	debounceWindows map[string]time.Duration
+	contentHashes   map[string][sha256.Size]byte
+	// imports maps a file to the files it imports or includes, they are watched with it
+	imports map[string][]string
+	// writableFile is the file which Set and Delete write to
+	writableFile string
+	writeMux     sync.Mutex
+	watchPool    *watch
+	filelock     sync.Mutex
+	priority     int
 	sync.RWMutex
 }
 
@@ -83,6 +105,7 @@ type watch struct {
 	watcher    *fsnotify.Watcher
 	callback   source.EventHandler
 	fileSource *Source
+	debouncer  *util.Debouncer
 	sync.RWMutex
 }
 
@@ -91,13 +114,16 @@ type watch struct {
   		1. Directory: all files considered as file source
   		2. File: specified file considered as file source
 
-  	TODO: Currently file sources priority not considered. if key conflicts then latest key will get considered
+	if key conflicts, the file with higher priority (lower value) wins,
+	if priorities are the same, the file added later wins
 */
 
 //FileSource is a interface
 type FileSource interface {
 	source.ConfigSource
 	AddFile(filePath string, priority uint32, handler util.FileHandler) error
+	AddFileWithOptions(filePath string, opts ...Option) error
+	RemoveFile(filePath string) error
 }
 
 //NewFileSource creates a source which can handler local files
@@ -105,16 +131,33 @@ func NewFileSource() FileSource {
 	fileConfigSource := new(Source)
 	fileConfigSource.priority = fileSourcePriority
 	fileConfigSource.files = make([]file, 0)
+	fileConfigSource.fileConfigs = make(map[string]map[string]interface{})
 	fileConfigSource.fileHandlers = make(map[string]util.FileHandler)
 	return fileConfigSource
 }
 
 //AddFile add file and manage configs
 func (fSource *Source) AddFile(p string, priority uint32, handle util.FileHandler) error {
+	return fSource.AddFileWithOptions(p, WithPriority(priority), WithHandler(handle))
+}
+
+//AddFileWithOptions add file, directory or glob like "conf/**/*.yaml" and manage configs,
+//files created later in a directory or matching a glob are added by watcher
+func (fSource *Source) AddFileWithOptions(p string, opts ...Option) error {
+	o := Options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
 	path, err := filepath.Abs(p)
 	if err != nil {
 		return err
 	}
+	if o.Writable {
+		return fSource.addWritableFile(path, o)
+	}
+	if isGlob(path) {
+		return fSource.addPattern(newGlobPattern(path, o))
+	}
 	// check existence of file
 	fs, err := os.Open(path)
 	if os.IsNotExist(err) {
@@ -122,39 +165,202 @@ func (fSource *Source) AddFile(p string, priority uint32, handle util.FileHandle
 	}
 	defer fs.Close()
 
-	// prevent duplicate file source
-	if fSource.isFileSrcExist(path) {
-		return nil
-	}
-	fSource.fileHandlers[path] = handle
 	fileType := fileType(fs)
 	switch fileType {
 	case Directory:
 		// handle Directory input. Include all files as file source.
-		err := fSource.handleDirectory(fs, priority, handle)
+		err := fSource.addPattern(newDirPattern(path, o))
 		if err != nil {
 			openlog.Error(fmt.Sprintf("Failed to handle directory [%s] %s", path, err))
 			return err
 		}
 	case RegularFile:
+		// prevent duplicate file source
+		if fSource.isFileSrcExist(path) {
+			return nil
+		}
 		// handle file and include as file source.
-		err := fSource.handleFile(fs, priority, handle)
+		err := fSource.handleFile(fs, o, fSource.callback())
 		if err != nil {
 			openlog.Error(fmt.Sprintf("Failed to handle file [%s] [%s]", path, err))
 			return err
 		}
+		fSource.watchDir(filepath.Dir(path))
 	case InvalidFileType:
 		openlog.Error(fmt.Sprintf("File type of [%s] not supported: %s", path, err))
 		return fmt.Errorf("file type of [%s] not supported", path)
 	}
 
-	if fSource.watchPool != nil {
-		fSource.watchPool.AddWatchFile(path)
+	return nil
+}
+
+//RemoveFile removes a file, directory or glob added before and stops watching it,
+//keys of removed files are deleted, or updated if another file still has them.
+//validators can't reject the removal
+func (fSource *Source) RemoveFile(p string) error {
+	path, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+	callback := fSource.callback()
+	fSource.filelock.Lock()
+	defer fSource.filelock.Unlock()
+
+	fSource.Lock()
+	files, patterns := fSource.files, fSource.patterns
+	removedPatterns := make([]*pattern, 0)
+	fSource.patterns = make([]*pattern, 0, len(patterns))
+	for _, pt := range patterns {
+		if pt.path == path {
+			removedPatterns = append(removedPatterns, pt)
+			continue
+		}
+		fSource.patterns = append(fSource.patterns, pt)
+	}
+	removed := make([]string, 0)
+	fSource.files = make([]file, 0, len(files))
+	for _, f := range files {
+		if f.filePath == path || fSource.onlyIn(removedPatterns, f.filePath) {
+			removed = append(removed, f.filePath)
+			delete(fSource.fileConfigs, f.filePath)
+			continue
+		}
+		fSource.files = append(fSource.files, f)
+	}
+	if len(removed) == 0 && len(removedPatterns) == 0 {
+		fSource.files, fSource.patterns = files, patterns
+		fSource.Unlock()
+		return fmt.Errorf("[%s] is not added", path)
 	}
+	merged := fSource.merge()
+	events := diff(fSource.Configurations, merged)
+	fSource.Configurations = merged
+	fSource.Unlock()
 
+	if callback != nil && len(events) > 0 {
+		if err := source.ApplyRemovalEvent(callback, events); err != nil {
+			openlog.Error(fmt.Sprintf("removal of [%s] is not applied: %s", path, err))
+		}
+	}
+	for _, f := range removed {
+		fSource.setFileError(callback, f, nil)
+	}
+	fSource.forget(removed, removedPatterns)
+	openlog.Info(fmt.Sprintf("[%s] is removed", path))
 	return nil
 }
 
+// onlyIn reports whether file belongs to one of removed patterns, but none of remaining ones.
+// it must be called with fSource locked
+func (fSource *Source) onlyIn(removed []*pattern, filePath string) bool {
+	for _, pt := range fSource.patterns {
+		if pt.match(filePath) {
+			return false
+		}
+	}
+	for _, pt := range removed {
+		if pt.match(filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// forget drops the states of removed files and patterns, stops polling them,
+// and stops watching directories nothing is left in
+func (fSource *Source) forget(files []string, patterns []*pattern) {
+	fSource.Lock()
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		delete(fSource.fileHandlers, f)
+		delete(fSource.pollIntervals, f)
+		delete(fSource.debounceWindows, f)
+		delete(fSource.contentHashes, f)
+		for _, i := range fSource.imports[f] {
+			dirs[filepath.Dir(i)] = true
+		}
+		delete(fSource.imports, f)
+		util.ForgetImports(f)
+		if stop, ok := fSource.polling[f]; ok {
+			close(stop)
+			delete(fSource.polling, f)
+		}
+		if fSource.writableFile == f {
+			fSource.writableFile = ""
+		}
+		dirs[filepath.Dir(f)] = true
+	}
+	for _, pt := range patterns {
+		if pt.stopPolling != nil {
+			close(pt.stopPolling)
+			pt.stopPolling = nil
+		}
+		_, watched, err := pt.scan()
+		if err != nil {
+			continue
+		}
+		for _, dir := range watched {
+			dirs[dir] = true
+		}
+	}
+	for dir := range dirs {
+		if fSource.isDirUsed(dir) {
+			delete(dirs, dir)
+		}
+	}
+	watchPool := fSource.watchPool
+	fSource.Unlock()
+	if watchPool != nil {
+		for dir := range dirs {
+			watchPool.RemoveWatchFile(dir)
+		}
+	}
+}
+
+// isDirUsed reports whether dir has files or imported files, or belongs to a pattern.
+// it must be called with fSource locked
+func (fSource *Source) isDirUsed(dir string) bool {
+	for _, f := range fSource.files {
+		if filepath.Dir(f.filePath) == dir {
+			return true
+		}
+	}
+	for _, imported := range fSource.imports {
+		for _, i := range imported {
+			if filepath.Dir(i) == dir {
+				return true
+			}
+		}
+	}
+	for _, pt := range fSource.patterns {
+		if pt.wantDir(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// callback returns the handler given by Watch, or nil if source is not watched yet
+func (fSource *Source) callback() source.EventHandler {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	if fSource.watchPool == nil {
+		return nil
+	}
+	return fSource.watchPool.callback
+}
+
+// watchDir watches a directory if source is watched,
+// files are watched by their directories, so that they are still watched after being replaced
+func (fSource *Source) watchDir(dir string) {
+	fSource.RLock()
+	watchPool := fSource.watchPool
+	fSource.RUnlock()
+	if watchPool != nil {
+		watchPool.AddWatchFile(dir)
+	}
+}
+
 func (fSource *Source) isFileSrcExist(filePath string) bool {
 	var exist bool
 	for _, file := range fSource.files {
@@ -182,35 +388,84 @@ func fileType(fs *os.File) FileSourceTypes {
 	return InvalidFileType
 }
 
-func (fSource *Source) handleDirectory(dir *os.File, priority uint32, handle util.FileHandler) error {
+// addPattern adds the files of a directory or glob, and remembers it to add files created later
+func (fSource *Source) addPattern(pt *pattern) error {
+	fSource.Lock()
+	fSource.patterns = append(fSource.patterns, pt)
+	fSource.Unlock()
+	if err := fSource.scanPattern(pt, fSource.callback()); err != nil {
+		return err
+	}
+	fSource.startPollingPattern(pt)
+	return nil
+}
 
-	filesInfo, err := dir.Readdir(-1)
+// scanPattern adds the files of pattern which are not added yet, and watches its directories
+func (fSource *Source) scanPattern(pt *pattern, callback source.EventHandler) error {
+	files, dirs, err := pt.scan()
 	if err != nil {
+		if os.IsNotExist(err) {
+			// files will be added once the directory is created
+			openlog.Debug(fmt.Sprintf("directory of [%s] not exist", pt.root))
+			return nil
+		}
 		return errors.New("failed to read Directory contents")
 	}
 
-	for _, fileInfo := range filesInfo {
-		filePath := filepath.Join(dir.Name(), fileInfo.Name())
-
+	for _, filePath := range files {
+		fSource.RLock()
+		exist := fSource.isFileSrcExist(filePath)
+		fSource.RUnlock()
+		if exist {
+			continue
+		}
 		fs, err := os.Open(filePath)
 		if err != nil {
 			openlog.Error(fmt.Sprintf("error in file open for %s file", err.Error()))
 			continue
 		}
 
-		err = fSource.handleFile(fs, priority, handle)
+		err = fSource.handleFile(fs, pt.opts, callback)
 		if err != nil {
 			openlog.Error(fmt.Sprintf("error processing %s file source handler with error : %s ", fs.Name(),
 				err.Error()))
 		}
 		fs.Close()
-
 	}
 
+	for _, dir := range dirs {
+		fSource.watchDir(dir)
+	}
 	return nil
 }
 
-func (fSource *Source) handleFile(file *os.File, priority uint32, handle util.FileHandler) error {
+// scanPatterns adds the files created in directories or matching globs
+func (fSource *Source) scanPatterns(callback source.EventHandler) {
+	fSource.RLock()
+	patterns := make([]*pattern, len(fSource.patterns))
+	copy(patterns, fSource.patterns)
+	fSource.RUnlock()
+	for _, pt := range patterns {
+		if err := fSource.scanPattern(pt, callback); err != nil {
+			openlog.Error(fmt.Sprintf("failed to scan [%s]: %s", pt.root, err))
+		}
+	}
+}
+
+// matchPattern reports whether file belongs to a directory or glob added to source
+func (fSource *Source) matchPattern(filePath string) bool {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	for _, pt := range fSource.patterns {
+		if pt.match(filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fSource *Source) handleFile(file *os.File, o Options, callback source.EventHandler) error {
+	handle := o.Handler
 	Content, err := ioutil.ReadFile(file.Name())
 	if err != nil {
 		return err
@@ -219,54 +474,126 @@ func (fSource *Source) handleFile(file *os.File, priority uint32, handle util.Fi
 	if handle != nil {
 		config, err = handle(file.Name(), Content)
 	} else {
-		config, err = util.Convert2JavaProps(file.Name(), Content)
+		config, err = util.GetFileHandler(file.Name())(file.Name(), Content)
 	}
 	if err != nil {
 		return fmt.Errorf("failed to pull configurations from [%s] file, %s", file.Name(), err)
 	}
 
-	err = fSource.handlePriority(file.Name(), priority)
+	fSource.RLock()
+	added := !fSource.isFileSrcExist(file.Name())
+	fSource.RUnlock()
+	err = fSource.handlePriority(file.Name(), o.Priority, handle)
+	fSource.trackImports(file.Name())
 	if err != nil {
 		return fmt.Errorf("failed to handle priority of [%s], %s", file.Name(), err)
 	}
 
-	events := fSource.compareUpdate(config, file.Name())
-	if fSource.watchPool != nil && fSource.watchPool.callback != nil { // if file source already added and try to add
-		for _, e := range events {
-			fSource.watchPool.callback.OnEvent(e)
+	fSource.setPollInterval(file.Name(), o.PollInterval)
+	fSource.setDebounceWindow(file.Name(), o.DebounceWindow)
+
+	fSource.filelock.Lock()
+	defer fSource.filelock.Unlock()
+	backup := fSource.snapshot()
+	events, merged := fSource.compareUpdate(config, file.Name())
+	// events are sent if file source already added and try to add
+	if err := fSource.fireEvents(callback, events, merged, backup); err != nil {
+		if added {
+			// a rejected file is not added, so that it can be added again once it is fixed
+			fSource.unregister(file.Name())
 		}
-		fSource.watchPool.callback.OnModuleEvent(events)
+		return fmt.Errorf("configurations of [%s] rejected, %s", file.Name(), err)
 	}
+	fSource.setContentHash(file.Name(), Content)
+	fSource.startPolling(file.Name())
 
 	return nil
 }
 
-func (fSource *Source) handlePriority(filePath string, priority uint32) error {
+// unregister removes a file which is added but not loaded
+func (fSource *Source) unregister(filePath string) {
 	fSource.Lock()
-	newFilePriority := make([]file, 0)
-	var prioritySet bool
+	files := make([]file, 0, len(fSource.files))
 	for _, f := range fSource.files {
-
-		if f.filePath == filePath && f.priority == priority {
-			prioritySet = true
-			newFilePriority = append(newFilePriority, file{
-				filePath: filePath,
-				priority: priority,
-			})
+		if f.filePath != filePath {
+			files = append(files, f)
 		}
-		newFilePriority = append(newFilePriority, f)
 	}
+	fSource.files = files
+	fSource.Unlock()
+	fSource.forget([]string{filePath}, nil)
+}
+
+// state is a copy of configurations, so that a rejected change can be rolled back
+type state struct {
+	configurations map[string]*ConfigInfo
+	fileConfigs    map[string]map[string]interface{}
+}
 
-	if !prioritySet {
-		newFilePriority = append(newFilePriority, file{
-			filePath: filePath,
-			priority: priority,
-		})
+// snapshot copies current configurations, key values of each file are replaced instead of modified,
+// so a shallow copy of fileConfigs is enough
+func (fSource *Source) snapshot() *state {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	backup := &state{
+		configurations: make(map[string]*ConfigInfo, len(fSource.Configurations)),
+		fileConfigs:    make(map[string]map[string]interface{}, len(fSource.fileConfigs)),
 	}
+	for key, confInfo := range fSource.Configurations {
+		if confInfo == nil {
+			backup.configurations[key] = nil
+			continue
+		}
+		c := *confInfo
+		backup.configurations[key] = &c
+	}
+	for filePath, configs := range fSource.fileConfigs {
+		backup.fileConfigs[filePath] = configs
+	}
+	return backup
+}
 
-	fSource.files = newFilePriority
-	fSource.Unlock()
+// fireEvents sends events as one batch, merged configurations are published only if they are accepted,
+// so that rejected values are never read. if they are rejected, key values of files are restored to backup
+func (fSource *Source) fireEvents(callback source.EventHandler, events []*event.Event,
+	merged map[string]*ConfigInfo, backup *state) error {
+	commit := func() {
+		fSource.Lock()
+		fSource.Configurations = merged
+		fSource.Unlock()
+	}
+	if callback == nil || len(events) == 0 { //avoid OnModuleEvent empty events error
+		commit()
+		return nil
+	}
+	err := source.CommitModuleEvent(callback, events, commit, func() {})
+	if err != nil {
+		fSource.Lock()
+		fSource.Configurations = backup.configurations
+		fSource.fileConfigs = backup.fileConfigs
+		fSource.Unlock()
+	}
+	return err
+}
 
+// handlePriority records priority and handler of file, a file added again keeps its place in order
+func (fSource *Source) handlePriority(filePath string, priority uint32, handle util.FileHandler) error {
+	fSource.Lock()
+	defer fSource.Unlock()
+	if fSource.fileHandlers == nil {
+		fSource.fileHandlers = make(map[string]util.FileHandler)
+	}
+	fSource.fileHandlers[filePath] = handle
+	for i, f := range fSource.files {
+		if f.filePath == filePath {
+			fSource.files[i].priority = priority
+			return nil
+		}
+	}
+	fSource.files = append(fSource.files, file{
+		filePath: filePath,
+		priority: priority,
+	})
 	return nil
 }
 
@@ -332,46 +659,61 @@ func (fSource *Source) Watch(callback source.EventHandler) error {
 		return err
 	}
 
+	fSource.Lock()
 	fSource.watchPool = watchPool
+	fSource.pollDone = make(chan struct{})
+	fSource.Unlock()
 
-	go fSource.watchPool.startWatchPool()
+	go watchPool.startWatchPool()
 
 	return nil
 }
 
+// newWatchPool creates a watch, if fsnotify does not work, its watcher is nil and all files are polled
 func newWatchPool(callback source.EventHandler, cfgSrc *Source) (*watch, error) {
-	watcher, err := fsnotify.NewWatcher()
+	watcher, err := newWatcher()
 	if err != nil {
-		openlog.Error("New file watcher failed:" + err.Error())
-		return nil, err
+		openlog.Error("New file watcher failed, poll files instead:" + err.Error())
+		watcher = nil
 	}
 
 	watch := new(watch)
 	watch.callback = callback
 	watch.fileSource = cfgSrc
 	watch.watcher = watcher
+	watch.debouncer = util.NewDebouncer()
 	openlog.Info("create new watcher")
 	return watch, nil
 }
 
 func (wth *watch) startWatchPool() {
+	defer wth.fileSource.startPollingAll()
+	if wth.watcher == nil {
+		return
+	}
 	go wth.watchFile()
-	for _, file := range wth.fileSource.files {
-		f, err := filepath.Abs(file.filePath)
-		if err != nil {
-			openlog.Error(fmt.Sprintf("failed to get Directory info from: %s file: %s", file.filePath, err))
-			return
-		}
-
-		err = wth.watcher.Add(f)
-		if err != nil {
-			openlog.Error(fmt.Sprintf("add watcher file: %+v fail %s", file, err))
-			return
-		}
+	wth.fileSource.RLock()
+	files := make([]file, len(wth.fileSource.files))
+	copy(files, wth.fileSource.files)
+	imported := make([]string, 0)
+	for _, i := range wth.fileSource.imports {
+		imported = append(imported, i...)
+	}
+	wth.fileSource.RUnlock()
+	for _, file := range files {
+		wth.AddWatchFile(filepath.Dir(file.filePath))
+	}
+	for _, f := range imported {
+		wth.AddWatchFile(filepath.Dir(f))
 	}
+	// watch directories of patterns, and add files created before watching
+	wth.fileSource.scanPatterns(wth.callback)
 }
 
 func (wth *watch) AddWatchFile(filePath string) {
+	if wth.watcher == nil {
+		return
+	}
 	err := wth.watcher.Add(filePath)
 	if err != nil {
 		openlog.Error(fmt.Sprintf("add watcher file: %s fail: %s", filePath, err))
@@ -379,6 +721,16 @@ func (wth *watch) AddWatchFile(filePath string) {
 	}
 }
 
+// RemoveWatchFile stops watching a directory
+func (wth *watch) RemoveWatchFile(filePath string) {
+	if wth.watcher == nil {
+		return
+	}
+	if err := wth.watcher.Remove(filePath); err != nil {
+		openlog.Debug(fmt.Sprintf("remove watcher file: %s fail: %s", filePath, err))
+	}
+}
+
 func (wth *watch) watchFile() {
 	for {
 		select {
@@ -387,176 +739,437 @@ func (wth *watch) watchFile() {
 				openlog.Warn("file watcher stop")
 				return
 			}
+			wth.handleEvent(event)
 
-			if strings.HasSuffix(event.Name, ".swx") || strings.HasSuffix(event.Name, ".swp") || strings.HasSuffix(event.Name, "~") {
-				//ignore
-				continue
+		case err, ok := <-wth.watcher.Errors:
+			if !ok {
+				openlog.Warn("file watcher stop")
+				return
 			}
-			openlog.Debug(fmt.Sprintf("file event %s, operation is %d. reload it.", event.Name, event.Op))
+			openlog.Error(fmt.Sprintf("watch file error: %s", err))
+		}
+	}
 
-			if event.Op == fsnotify.Remove {
-				openlog.Warn(fmt.Sprintf("the file change mode: %s, continue", event.String()))
-				continue
-			}
+}
 
-			if event.Op == fsnotify.Rename {
-				openlog.Debug("file renamed")
-				wth.watcher.Remove(event.Name)
-				// check existence of file
-				_, err := os.Open(event.Name)
-				if os.IsNotExist(err) {
-					openlog.Warn(fmt.Sprintf("[%s] file does not exist so not able to watch further:%s", event.Name, err))
-				} else {
-					wth.AddWatchFile(event.Name)
-				}
+// handleEvent handles an event of a watched directory
+func (wth *watch) handleEvent(event fsnotify.Event) {
+	if isTempFile(event.Name) {
+		//ignore
+		return
+	}
+	openlog.Debug(fmt.Sprintf("file event %s, operation is %d. reload it.", event.Name, event.Op))
+	fSource := wth.fileSource
+
+	if event.Op&fsnotify.Create != 0 {
+		openlog.Debug("file created")
+		time.Sleep(time.Millisecond)
+		if fSource.isNewInPattern(event.Name) {
+			// a new file matching a directory or glob, or a new directory which may have such files,
+			// it is scanned once it is written completely
+			wth.debouncer.Debounce(event.Name, DefaultDebounceWindow, func() {
+				fSource.scanPatterns(wth.callback)
+			})
+			return
+		}
+	}
 
-				continue
-			}
+	fSource.RLock()
+	exist := fSource.isFileSrcExist(event.Name)
+	fSource.RUnlock()
+	if importers := fSource.importers(event.Name); len(importers) > 0 {
+		// files importing the changed one are loaded again
+		for _, f := range importers {
+			wth.debounceReload(f, fSource.debounceWindow(f))
+		}
+	}
+	if !exist {
+		// the symlinks of files may be swapped, like "..data" of kubernetes config map
+		for _, f := range fSource.symlinkedFiles(filepath.Dir(event.Name)) {
+			wth.debounceReload(f, fSource.debounceWindow(f))
+		}
+		return
+	}
 
-			if event.Op == fsnotify.Create {
-				openlog.Debug("file created")
-				time.Sleep(time.Millisecond)
-			}
-			handle := wth.fileSource.fileHandlers[event.Name]
-			if handle == nil {
-				openlog.Debug("user default file handler")
-				handle = util.Convert2JavaProps
-			}
-			content, err := ioutil.ReadFile(event.Name)
-			if err != nil {
-				openlog.Error("read file error " + err.Error())
-				continue
-			}
+	window := fSource.debounceWindow(event.Name)
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && window < deleteGracePeriod {
+		// editors and deploy tools replace a file by removing or renaming it, and then create it again,
+		// so the file is checked later to avoid deleting its configurations by mistake
+		window = deleteGracePeriod
+	}
+	wth.debounceReload(event.Name, window)
+}
 
-			newConf, err := handle(event.Name, content)
-			if err != nil {
-				openlog.Error("convert error " + err.Error())
-				continue
-			}
-			openlog.Debug(fmt.Sprintf("new config: %v", newConf))
-			events := wth.fileSource.compareUpdate(newConf, event.Name)
-			openlog.Debug(fmt.Sprintf("generated events %v", events))
-			if len(events) > 0 { //avoid OnModuleEvent empty events error
-				for _, e := range events {
-					wth.callback.OnEvent(e)
-				}
-				wth.callback.OnModuleEvent(events)
-			}
+// debounceReload reloads file once it is quiet for window, so that the events of one save cause one reload
+func (wth *watch) debounceReload(filePath string, window time.Duration) {
+	wth.debouncer.Debounce(filePath, window, func() {
+		wth.reload(filePath)
+	})
+}
 
-		case err := <-wth.watcher.Errors:
-			openlog.Debug(fmt.Sprintf("watch file error: %s", err))
-			return
-		}
+// reload reads file again, if it does not exist any more, its configurations are deleted
+func (wth *watch) reload(filePath string) {
+	var err error
+	if _, statErr := os.Stat(filePath); os.IsNotExist(statErr) {
+		openlog.Warn(fmt.Sprintf("[%s] file is deleted", filePath))
+		err = wth.fileSource.deleteFileConfigs(wth.callback, filePath)
+	} else {
+		err = wth.fileSource.reloadFile(wth.callback, filePath)
+	}
+	if err != nil {
+		openlog.Error(err.Error())
 	}
-
 }
 
-func (fSource *Source) compareUpdate(configs map[string]interface{}, filePath string) []*event.Event {
-	events := make([]*event.Event, 0)
-	fileConfs := make(map[string]*ConfigInfo)
-	if fSource == nil {
-		return nil
+// symlinkedFiles returns the added files in dir which are symlinks
+func (fSource *Source) symlinkedFiles(dir string) []string {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	files := make([]string, 0)
+	for _, f := range fSource.files {
+		if filepath.Dir(f.filePath) != dir {
+			continue
+		}
+		if info, err := os.Lstat(f.filePath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			files = append(files, f.filePath)
+		}
 	}
+	return files
+}
 
-	fSource.Lock()
-	defer fSource.Unlock()
+// deleteFileConfigs deletes configurations of a deleted file, the file is still managed,
+// so its configurations come back once it is created again
+func (fSource *Source) deleteFileConfigs(callback source.EventHandler, filePath string) error {
+	fSource.setFileError(callback, filePath, nil)
+	fSource.setContentHash(filePath, nil)
+	fSource.filelock.Lock()
+	defer fSource.filelock.Unlock()
+	backup := fSource.snapshot()
+	events, merged := fSource.compareUpdate(nil, filePath)
+	if err := fSource.fireEvents(callback, events, merged, backup); err != nil {
+		return fmt.Errorf("deletion of [%s] rejected: %s", filePath, err)
+	}
+	return nil
+}
 
-	var filePathPriority uint32 = math.MaxUint32
-	for _, file := range fSource.files {
-		if file.filePath == filePath {
-			filePathPriority = file.priority
+// isNewInPattern reports whether path is not added yet, but belongs to a directory or glob
+func (fSource *Source) isNewInPattern(path string) bool {
+	fSource.RLock()
+	exist := fSource.isFileSrcExist(path)
+	fSource.RUnlock()
+	if exist {
+		return false
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		fSource.RLock()
+		defer fSource.RUnlock()
+		for _, pt := range fSource.patterns {
+			if pt.wantDir(path) {
+				return true
+			}
 		}
+		return false
 	}
+	return fSource.matchPattern(path)
+}
 
-	if filePathPriority == math.MaxUint32 {
+// reloadFile reads file again and fires events of its changes
+func (fSource *Source) reloadFile(callback source.EventHandler, filePath string) error {
+	fSource.RLock()
+	exist := fSource.isFileSrcExist(filePath)
+	fSource.RUnlock()
+	if !exist {
 		return nil
 	}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		fSource.setFileError(callback, filePath, err)
+		return fmt.Errorf("read file error %s", err)
+	}
+	if len(fSource.importsOf(filePath)) == 0 && fSource.isContentLoaded(filePath, content) {
+		// like a file touched, or saved back to the last good content after an error
+		openlog.Debug(fmt.Sprintf("content of [%s] is not changed", filePath))
+		fSource.setFileError(callback, filePath, nil)
+		return nil
+	}
+	return fSource.loadContent(callback, filePath, content)
+}
 
-	// update and delete with latest configs
+// loadContent converts content of file and fires events of its changes,
+// if content can not be converted, the last good configurations of file are kept
+func (fSource *Source) loadContent(callback source.EventHandler, filePath string, content []byte) error {
+	fSource.RLock()
+	handle := fSource.fileHandlers[filePath]
+	fSource.RUnlock()
+	if handle == nil {
+		openlog.Debug("use file handler registered for extension")
+		handle = util.GetFileHandler(filePath)
+	}
+	newConf, err := handle(filePath, content)
+	// imports may change even if the file fails to load, they are still watched to load it again
+	fSource.trackImports(filePath)
+	if err != nil {
+		fSource.setFileError(callback, filePath, err)
+		return fmt.Errorf("convert error %s", err)
+	}
+	fSource.setFileError(callback, filePath, nil)
+	openlog.Debug(fmt.Sprintf("new config: %v", newConf))
+	fSource.filelock.Lock()
+	defer fSource.filelock.Unlock()
+	backup := fSource.snapshot()
+	events, merged := fSource.compareUpdate(newConf, filePath)
+	openlog.Debug(fmt.Sprintf("generated events %v", events))
+	if err := fSource.fireEvents(callback, events, merged, backup); err != nil {
+		return fmt.Errorf("changes of [%s] rejected: %s", filePath, err)
+	}
+	// a watch event of the same content, like the one caused by Set, is not applied again
+	fSource.setContentHash(filePath, content)
+	return nil
+}
 
-	for key, confInfo := range fSource.Configurations {
-		if confInfo == nil {
-			continue
+//Flush reloads all files synchronously, and adds files created in directories or matching globs,
+//so that changes not reported by watcher yet are applied
+func (fSource *Source) Flush(callback source.EventHandler) error {
+	fSource.scanPatterns(callback)
+	fSource.RLock()
+	paths := make([]string, 0, len(fSource.files))
+	for _, f := range fSource.files {
+		paths = append(paths, f.filePath)
+	}
+	fSource.RUnlock()
+
+	var flushErr error
+	for _, p := range paths {
+		var err error
+		if _, statErr := os.Stat(p); os.IsNotExist(statErr) {
+			err = fSource.deleteFileConfigs(callback, p)
+		} else {
+			err = fSource.reloadFile(callback, p)
+		}
+		if err != nil {
+			openlog.Error(err.Error())
+			if flushErr == nil {
+				flushErr = err
+			}
 		}
+	}
+	return flushErr
+}
 
-		switch confInfo.FilePath {
-		case filePath:
-			newConfValue, ok := configs[key]
-			if !ok {
-				events = append(events, &event.Event{EventSource: FileConfigSourceConst, Key: key,
-					EventType: event.Delete, Value: confInfo.Value})
-				continue
-			} else if reflect.DeepEqual(confInfo.Value, newConfValue) {
-				fileConfs[key] = confInfo
+//Reload reloads all files like Flush, so that a file fixed by operators is loaded even if watcher missed it
+func (fSource *Source) Reload(callback source.EventHandler) error {
+	return fSource.Flush(callback)
+}
+
+// compareUpdate replaces key values of file and merges all files again, nil configs means file is deleted.
+// it returns the events of merged key values and the merged configurations, which are published by fireEvents
+func (fSource *Source) compareUpdate(configs map[string]interface{}, filePath string) ([]*event.Event, map[string]*ConfigInfo) {
+	fSource.Lock()
+	defer fSource.Unlock()
+	if !fSource.isFileSrcExist(filePath) {
+		return nil, fSource.Configurations
+	}
+	if fSource.fileConfigs == nil {
+		fSource.fileConfigs = make(map[string]map[string]interface{})
+	}
+	if configs == nil {
+		delete(fSource.fileConfigs, filePath)
+	} else {
+		fSource.fileConfigs[filePath] = configs
+	}
+	merged := fSource.merge()
+	return diff(fSource.Configurations, merged), merged
+}
+
+// merge resolves the conflicts between files, a key takes the value of the file with highest priority (lowest value),
+// if priorities are the same, the file added later wins. it must be called with fSource locked
+func (fSource *Source) merge() map[string]*ConfigInfo {
+	merged := make(map[string]*ConfigInfo)
+	winners := make(map[string]uint32)
+	for _, f := range fSource.files {
+		for key, value := range fSource.fileConfigs[f.filePath] {
+			if priority, ok := winners[key]; ok && priority < f.priority {
 				continue
 			}
+			winners[key] = f.priority
+			merged[key] = &ConfigInfo{FilePath: f.filePath, Value: value}
+		}
+	}
+	return merged
+}
 
-			confInfo.Value = newConfValue
-			fileConfs[key] = confInfo
-
+// diff returns the events which change old configurations into new ones, sorted by key
+func diff(old, new map[string]*ConfigInfo) []*event.Event {
+	events := make([]*event.Event, 0)
+	for key, confInfo := range old {
+		if confInfo == nil {
+			continue
+		}
+		newConfInfo, ok := new[key]
+		if !ok {
 			events = append(events, &event.Event{EventSource: FileConfigSourceConst, Key: key,
-				EventType: event.Update, Value: newConfValue})
-
-		default: // configuration file not same
-			// no need to handle delete scenario
-			// only handle if configuration conflicts between two sources
-			newConfValue, ok := configs[key]
-			if ok {
-				var priority uint32 = math.MaxUint32
-				for _, file := range fSource.files {
-					if file.filePath == confInfo.FilePath {
-						priority = file.priority
-					}
-				}
-
-				if priority == filePathPriority {
-					fileConfs[key] = confInfo
-					openlog.Info(fmt.Sprintf("Two files have same priority. keeping %s value", confInfo.FilePath))
-
-				} else if filePathPriority < priority { // lower the vale higher is the priority
-					confInfo.Value = newConfValue
-					fileConfs[key] = confInfo
-					events = append(events, &event.Event{EventSource: FileConfigSourceConst,
-						Key: key, EventType: event.Update, Value: newConfValue})
-
-				} else {
-					fileConfs[key] = confInfo
-				}
-			} else {
-				fileConfs[key] = confInfo
-			}
+				EventType: event.Delete, Value: confInfo.Value})
+			continue
+		}
+		if !reflect.DeepEqual(confInfo.Value, newConfInfo.Value) {
+			events = append(events, &event.Event{EventSource: FileConfigSourceConst, Key: key,
+				EventType: event.Update, Value: newConfInfo.Value})
 		}
 	}
+	for key, confInfo := range new {
+		if oldConfInfo, ok := old[key]; ok && oldConfInfo != nil {
+			continue
+		}
+		events = append(events, &event.Event{EventSource: FileConfigSourceConst, Key: key,
+			EventType: event.Create, Value: confInfo.Value})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
 
-	// create add/create new config
-	fileConfs, events = fSource.addOrCreateConf(fileConfs, configs, events, filePath)
+// setDebounceWindow records the debounce window of file, 0 keeps the window set before
+func (fSource *Source) setDebounceWindow(filePath string, window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	fSource.Lock()
+	defer fSource.Unlock()
+	if fSource.debounceWindows == nil {
+		fSource.debounceWindows = make(map[string]time.Duration)
+	}
+	fSource.debounceWindows[filePath] = window
+}
 
-	fSource.Configurations = fileConfs
+func (fSource *Source) debounceWindow(filePath string) time.Duration {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	if window, ok := fSource.debounceWindows[filePath]; ok {
+		return window
+	}
+	return DefaultDebounceWindow
+}
 
-	return events
+// setContentHash records the hash of content loaded from file, nil content means file is deleted
+func (fSource *Source) setContentHash(filePath string, content []byte) {
+	fSource.Lock()
+	defer fSource.Unlock()
+	if content == nil {
+		delete(fSource.contentHashes, filePath)
+		return
+	}
+	if fSource.contentHashes == nil {
+		fSource.contentHashes = make(map[string][sha256.Size]byte)
+	}
+	fSource.contentHashes[filePath] = sha256.Sum256(content)
 }
 
-func (fSource *Source) addOrCreateConf(fileConfs map[string]*ConfigInfo, newconf map[string]interface{},
-	events []*event.Event, filePath string) (map[string]*ConfigInfo, []*event.Event) {
-	for key, value := range newconf {
-		handled := false
+// isContentLoaded reports whether content is the same as the one loaded from file last time
+func (fSource *Source) isContentLoaded(filePath string, content []byte) bool {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	hash, ok := fSource.contentHashes[filePath]
+	return ok && hash == sha256.Sum256(content)
+}
 
-		_, ok := fileConfs[key]
-		if ok {
-			handled = true
+// trackImports records the files imported by file and watches them
+func (fSource *Source) trackImports(filePath string) {
+	imported := util.ImportedFiles(filePath)
+	fSource.Lock()
+	if len(imported) == 0 {
+		delete(fSource.imports, filePath)
+	} else {
+		if fSource.imports == nil {
+			fSource.imports = make(map[string][]string)
 		}
+		fSource.imports[filePath] = imported
+	}
+	fSource.Unlock()
+	for _, f := range imported {
+		fSource.watchDir(filepath.Dir(f))
+	}
+}
 
-		if !handled {
-			events = append(events, &event.Event{EventSource: FileConfigSourceConst, Key: key,
-				EventType: event.Create, Value: value})
-			fileConfs[key] = &ConfigInfo{
-				FilePath: filePath,
-				Value:    value,
+func (fSource *Source) importsOf(filePath string) []string {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	return fSource.imports[filePath]
+}
+
+// importers returns the files which import or include filePath
+func (fSource *Source) importers(filePath string) []string {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	files := make([]string, 0)
+	for f, imported := range fSource.imports {
+		for _, i := range imported {
+			if i == filePath {
+				files = append(files, f)
+				break
 			}
 		}
 	}
+	sort.Strings(files)
+	return files
+}
 
-	return fileConfs, events
+// setFileError records the error of file and reports it to callback, nil err means file loads again.
+// the same error is reported only once
+func (fSource *Source) setFileError(callback source.EventHandler, filePath string, err error) {
+	fSource.Lock()
+	last, failed := fSource.fileErrors[filePath]
+	if err == nil {
+		if !failed {
+			fSource.Unlock()
+			return
+		}
+		delete(fSource.fileErrors, filePath)
+	} else if failed && last.Err.Error() == err.Error() {
+		fSource.Unlock()
+		return
+	}
+	e := &event.SourceError{EventSource: FileConfigSourceConst, Location: filePath,
+		Line: util.ErrorLine(err), Err: err, Time: time.Now()}
+	if err != nil {
+		if fSource.fileErrors == nil {
+			fSource.fileErrors = make(map[string]*event.SourceError)
+		}
+		fSource.fileErrors[filePath] = e
+		openlog.Error(fmt.Sprintf("[%s] fails to load, keep last good configurations: %s", filePath, err))
+	} else {
+		openlog.Info(fmt.Sprintf("[%s] loads again", filePath))
+	}
+	fSource.Unlock()
+	if callback != nil {
+		source.ReportError(callback, e)
+	}
+}
+
+//Errors returns the files which fail to load, sorted by path
+func (fSource *Source) Errors() []*event.SourceError {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	errs := make([]*event.SourceError, 0, len(fSource.fileErrors))
+	for _, e := range fSource.fileErrors {
+		c := *e
+		errs = append(errs, &c)
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Location < errs[j].Location
+	})
+	return errs
+}
+
+//KeyLocation returns the file which the value of key comes from
+func (fSource *Source) KeyLocation(key string) (string, bool) {
+	fSource.RLock()
+	defer fSource.RUnlock()
+	confInfo, ok := fSource.Configurations[key]
+	if !ok || confInfo == nil {
+		return "", false
+	}
+	return confInfo.FilePath, true
 }
 
 //Cleanup clear all configs
@@ -564,12 +1177,32 @@ func (fSource *Source) Cleanup() error {
 	fSource.filelock.Lock()
 	defer fSource.filelock.Unlock()
 
+	fSource.Lock()
 	if fSource.watchPool != nil && fSource.watchPool.watcher != nil {
 		fSource.watchPool.watcher.Close()
 	}
-
+	if fSource.watchPool != nil {
+		fSource.watchPool.debouncer.Stop()
+	}
+	if fSource.pollDone != nil {
+		close(fSource.pollDone)
+		fSource.pollDone = nil
+	}
+	fSource.polling = nil
+	fSource.pollIntervals = nil
 	fSource.files = make([]file, 0)
+	fSource.patterns = nil
+	fSource.fileErrors = nil
+	fSource.debounceWindows = nil
+	fSource.contentHashes = nil
+	for f := range fSource.imports {
+		util.ForgetImports(f)
+	}
+	fSource.imports = nil
+	fSource.writableFile = ""
+	fSource.fileConfigs = make(map[string]map[string]interface{})
 	fSource.Configurations = make(map[string]*ConfigInfo, 0)
+	fSource.Unlock()
 	return nil
 }
 
@@ -577,13 +1210,3 @@ func (fSource *Source) Cleanup() error {
 func (fSource *Source) AddDimensionInfo(labels map[string]string) error {
 	return nil
 }
-
-//Set no use
-func (fSource *Source) Set(key string, value interface{}) error {
-	return nil
-}
-
-//Delete no use
-func (fSource *Source) Delete(key string) error {
-	return nil
-}
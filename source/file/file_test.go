@@ -22,13 +22,18 @@ package filesource_test
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/go-chassis/go-archaius/event"
+	"github.com/go-chassis/go-archaius/source"
 	filesource "github.com/go-chassis/go-archaius/source/file"
+	"github.com/go-chassis/go-archaius/source/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -138,3 +143,465 @@ others:
 		assert.Equal(t, nil, age)
 	})
 }
+
+func TestDotEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dotenv")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	envFile := filepath.Join(dir, ".env")
+	err = ioutil.WriteFile(envFile, []byte("export DB_HOST=localhost\nDB_PORT=5432\n"), 0600)
+	assert.NoError(t, err)
+
+	fSource := filesource.NewFileSource()
+	err = fSource.AddFile(envFile, 0, nil)
+	assert.NoError(t, err)
+	v, err := fSource.GetConfigurationByKey("DB.HOST")
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost", v)
+
+	err = ioutil.WriteFile(envFile, []byte("export DB_HOST=localhost\nDB_PORT=5433\n"), 0600)
+	assert.NoError(t, err)
+	h := new(TestDynamicConfigHandler)
+	err = fSource.(source.Flusher).Flush(h)
+	assert.NoError(t, err)
+	assert.Equal(t, event.Update, h.EventName)
+	assert.Equal(t, "5433", h.EventValue)
+	v, err = fSource.GetConfigurationByKey("DB.PORT")
+	assert.NoError(t, err)
+	assert.Equal(t, "5433", v)
+}
+
+type recordHandler struct {
+	events []*event.Event
+}
+
+func (h *recordHandler) OnEvent(e *event.Event) {}
+
+func (h *recordHandler) OnModuleEvent(events []*event.Event) {
+	h.events = append(h.events, events...)
+}
+
+func TestFilePriority(t *testing.T) {
+	dir, err := ioutil.TempDir("", "priority")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	high := filepath.Join(dir, "high.yaml")
+	low := filepath.Join(dir, "low.yaml")
+	same := filepath.Join(dir, "same.yaml")
+	assert.NoError(t, ioutil.WriteFile(high, []byte("a: high\nb: high\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(low, []byte("a: low\nc: low\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(same, []byte("b: same\n"), 0600))
+
+	fSource := filesource.NewFileSource()
+	assert.NoError(t, fSource.AddFile(high, 1, nil))
+	assert.NoError(t, fSource.AddFile(low, 2, nil))
+	t.Run("higher priority wins on load", func(t *testing.T) {
+		v, err := fSource.GetConfigurationByKey("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "high", v)
+		location, ok := fSource.(source.KeyLocator).KeyLocation("c")
+		assert.True(t, ok)
+		assert.Equal(t, low, location)
+	})
+	t.Run("file added later wins if priorities are the same", func(t *testing.T) {
+		assert.NoError(t, fSource.AddFile(same, 1, nil))
+		v, err := fSource.GetConfigurationByKey("b")
+		assert.NoError(t, err)
+		assert.Equal(t, "same", v)
+	})
+
+	h := &recordHandler{}
+	t.Run("change of lower priority file is hidden", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(low, []byte("a: low2\nc: low\n"), 0600))
+		assert.NoError(t, fSource.(source.Flusher).Flush(h))
+		assert.Len(t, h.events, 0)
+		v, err := fSource.GetConfigurationByKey("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "high", v)
+	})
+	t.Run("removed key falls back to lower priority file", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(high, []byte("b: high\n"), 0600))
+		assert.NoError(t, fSource.(source.Flusher).Flush(h))
+		if assert.Len(t, h.events, 1) {
+			assert.Equal(t, "a", h.events[0].Key)
+			assert.Equal(t, event.Update, h.events[0].EventType)
+			assert.Equal(t, "low2", h.events[0].Value)
+		}
+		location, ok := fSource.(source.KeyLocator).KeyLocation("a")
+		assert.True(t, ok)
+		assert.Equal(t, low, location)
+	})
+}
+
+func TestAddFileWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pattern")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.yaml"), []byte("a: 1\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub", "b.yml"), []byte("b: 1\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub", "c.yaml.bak"), []byte("c: 1\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub", "d.yaml.swp"), []byte("d: 1\n"), 0600))
+
+	t.Run("glob", func(t *testing.T) {
+		files, err := filesource.Glob(filepath.Join(dir, "*.yaml"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(dir, "a.yaml")}, files)
+		files, err = filesource.Glob(filepath.Join(dir, "**", "*.yml"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(dir, "sub", "b.yml")}, files)
+		files, err = filesource.Glob(filepath.Join(dir, "none", "*.yml"))
+		assert.NoError(t, err)
+		assert.Len(t, files, 0)
+	})
+	t.Run("recursive directory with filters", func(t *testing.T) {
+		fSource := filesource.NewFileSource()
+		err := fSource.AddFileWithOptions(dir, filesource.WithRecursive(), filesource.WithExclude("*.bak"))
+		assert.NoError(t, err)
+		configs, err := fSource.GetConfigurations()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": 1, "b": 1}, configs)
+
+		fSource = filesource.NewFileSource()
+		err = fSource.AddFileWithOptions(dir, filesource.WithRecursive(), filesource.WithInclude("sub/*"))
+		assert.NoError(t, err)
+		configs, err = fSource.GetConfigurations()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"b": 1, "c": 1}, configs)
+	})
+	t.Run("file created later matching glob is added", func(t *testing.T) {
+		fSource := filesource.NewFileSource()
+		err := fSource.AddFile(filepath.Join(dir, "**", "*.yaml"), 0, nil)
+		assert.NoError(t, err)
+		h := &recordHandler{}
+		assert.NoError(t, fSource.Watch(h))
+		defer fSource.Cleanup()
+
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, "new"), 0700))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "new", "e.yaml"), []byte("e: 1\n"), 0600))
+		assert.Eventually(t, func() bool {
+			v, err := fSource.GetConfigurationByKey("e")
+			return err == nil && v == 1
+		}, 3*time.Second, 10*time.Millisecond)
+	})
+}
+
+type lockedHandler struct {
+	mu     sync.Mutex
+	events []*event.Event
+}
+
+func (h *lockedHandler) OnEvent(e *event.Event) {}
+
+func (h *lockedHandler) OnModuleEvent(events []*event.Event) {
+	h.mu.Lock()
+	h.events = append(h.events, events...)
+	h.mu.Unlock()
+}
+
+func (h *lockedHandler) count(eventType string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, e := range h.events {
+		if e.EventType == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWatchReplacedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	app := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, ioutil.WriteFile(app, []byte("a: 1\n"), 0600))
+
+	fSource := filesource.NewFileSource()
+	assert.NoError(t, fSource.AddFile(app, 0, nil))
+	h := &lockedHandler{}
+	assert.NoError(t, fSource.Watch(h))
+	defer fSource.Cleanup()
+	valueOf := func(key string) interface{} {
+		v, _ := fSource.GetConfigurationByKey(key)
+		return v
+	}
+	// wait for watcher to start
+	time.Sleep(50 * time.Millisecond)
+
+	t.Run("atomic rename", func(t *testing.T) {
+		tmp := filepath.Join(dir, "app.yaml.tmp")
+		assert.NoError(t, ioutil.WriteFile(tmp, []byte("a: 2\n"), 0600))
+		assert.NoError(t, os.Rename(tmp, app))
+		assert.Eventually(t, func() bool { return valueOf("a") == 2 }, 3*time.Second, 10*time.Millisecond)
+	})
+	t.Run("delete and recreate", func(t *testing.T) {
+		assert.NoError(t, os.Remove(app))
+		assert.NoError(t, ioutil.WriteFile(app, []byte("a: 3\n"), 0600))
+		assert.Eventually(t, func() bool { return valueOf("a") == 3 }, 3*time.Second, 10*time.Millisecond)
+		time.Sleep(200 * time.Millisecond)
+		assert.Equal(t, 0, h.count(event.Delete))
+	})
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, os.Remove(app))
+		assert.Eventually(t, func() bool { return h.count(event.Delete) == 1 }, 3*time.Second, 10*time.Millisecond)
+		assert.Nil(t, valueOf("a"))
+	})
+}
+
+func TestWatchSymlinkSwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configmap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// the layout of a kubernetes config map volume
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..v1"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "..v1", "app.yaml"), []byte("a: 1\n"), 0600))
+	assert.NoError(t, os.Symlink("..v1", filepath.Join(dir, "..data")))
+	app := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, os.Symlink(filepath.Join("..data", "app.yaml"), app))
+
+	fSource := filesource.NewFileSource()
+	assert.NoError(t, fSource.AddFile(app, 0, nil))
+	assert.NoError(t, fSource.Watch(&lockedHandler{}))
+	defer fSource.Cleanup()
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..v2"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "..v2", "app.yaml"), []byte("a: 2\n"), 0600))
+	assert.NoError(t, os.Symlink("..v2", filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, "..v1")))
+	assert.Eventually(t, func() bool {
+		v, _ := fSource.GetConfigurationByKey("a")
+		return v == 2
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+func TestDebounceReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debounce")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	app := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, ioutil.WriteFile(app, []byte("a: 1\nb: 1\n"), 0600))
+	var parsed int32
+	handler := func(p string, content []byte) (map[string]interface{}, error) {
+		atomic.AddInt32(&parsed, 1)
+		return util.Convert2JavaProps(p, content)
+	}
+
+	fSource := filesource.NewFileSource()
+	assert.NoError(t, fSource.AddFileWithOptions(app, filesource.WithHandler(handler),
+		filesource.WithDebounce(100*time.Millisecond)))
+	h := &lockedHandler{}
+	assert.NoError(t, fSource.Watch(h))
+	defer fSource.Cleanup()
+	time.Sleep(50 * time.Millisecond)
+
+	t.Run("partial writes cause one change", func(t *testing.T) {
+		f, err := os.OpenFile(app, os.O_WRONLY|os.O_TRUNC, 0600)
+		assert.NoError(t, err)
+		for _, part := range []string{"a: 2\n", "b: 2\n"} {
+			time.Sleep(10 * time.Millisecond)
+			_, err = f.WriteString(part)
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, f.Close())
+		assert.Eventually(t, func() bool { return h.count(event.Update) == 2 }, 3*time.Second, 10*time.Millisecond)
+		time.Sleep(200 * time.Millisecond)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&parsed))
+		assert.Equal(t, 2, h.count(event.Update))
+		assert.Equal(t, 0, h.count(event.Delete))
+		assert.Equal(t, 0, h.count(event.Create))
+	})
+	t.Run("same content is not parsed", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(app, []byte("a: 2\nb: 2\n"), 0600))
+		time.Sleep(200 * time.Millisecond)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&parsed))
+	})
+}
+
+func TestWatchImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imports")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "common"), 0700))
+	common := filepath.Join(dir, "common", "retry.yaml")
+	assert.NoError(t, ioutil.WriteFile(common, []byte("retry: 1\n"), 0600))
+	app := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, ioutil.WriteFile(app, []byte("archaius.imports: [common/retry.yaml]\nname: app\n"), 0600))
+
+	fSource := filesource.NewFileSource()
+	assert.NoError(t, fSource.AddFile(app, 0, nil))
+	h := &lockedHandler{}
+	assert.NoError(t, fSource.Watch(h))
+	defer fSource.Cleanup()
+	valueOf := func(key string) interface{} {
+		v, _ := fSource.GetConfigurationByKey(key)
+		return v
+	}
+	assert.Equal(t, 1, valueOf("retry"))
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NoError(t, ioutil.WriteFile(common, []byte("retry: 2\n"), 0600))
+	assert.Eventually(t, func() bool { return valueOf("retry") == 2 }, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, h.count(event.Update))
+	assert.Equal(t, "app", valueOf("name"))
+	location, _ := fSource.(source.KeyLocator).KeyLocation("retry")
+	assert.Equal(t, app, location)
+
+	// imports of a removed file are neither reported nor watched
+	assert.NoError(t, fSource.RemoveFile(app))
+	assert.Empty(t, util.ImportedFiles(app))
+	assert.NoError(t, ioutil.WriteFile(common, []byte("retry: 3\n"), 0600))
+	time.Sleep(200 * time.Millisecond)
+	assert.Nil(t, valueOf("retry"))
+	assert.Equal(t, 1, h.count(event.Update))
+}
+
+func TestWritableFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "writable")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	app := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, ioutil.WriteFile(app, []byte("# thresholds\nlimit:\n  qps: 100 # tuned\nname: app\n"), 0600))
+
+	fSource := filesource.NewFileSource()
+	assert.NoError(t, fSource.AddFileWithOptions(app, filesource.WithWritable()))
+	h := &lockedHandler{}
+	assert.NoError(t, fSource.Watch(h))
+	defer fSource.Cleanup()
+	time.Sleep(50 * time.Millisecond)
+	valueOf := func(key string) interface{} {
+		v, _ := fSource.GetConfigurationByKey(key)
+		return v
+	}
+
+	t.Run("set", func(t *testing.T) {
+		assert.NoError(t, fSource.Set("limit.qps", 200))
+		assert.NoError(t, fSource.Set("limit.burst", 10))
+		assert.Equal(t, 200, valueOf("limit.qps"))
+		b, err := ioutil.ReadFile(app)
+		assert.NoError(t, err)
+		assert.Equal(t, "# thresholds\nlimit:\n  qps: 200 # tuned\n  burst: 10\nname: app\n", string(b))
+		// watch events of the writes are not applied again
+		time.Sleep(200 * time.Millisecond)
+		assert.Equal(t, 1, h.count(event.Update))
+		assert.Equal(t, 1, h.count(event.Create))
+	})
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, fSource.Delete("limit.qps"))
+		assert.NoError(t, fSource.Delete("limit.burst"))
+		assert.NoError(t, fSource.Delete("not.exist"))
+		assert.Nil(t, valueOf("limit.qps"))
+		b, err := ioutil.ReadFile(app)
+		assert.NoError(t, err)
+		assert.Equal(t, "# thresholds\nname: app\n", string(b))
+	})
+	t.Run("created if not exist", func(t *testing.T) {
+		runtime := filepath.Join(dir, "runtime.yaml")
+		assert.NoError(t, fSource.AddFileWithOptions(runtime, filesource.WithWritable()))
+		assert.NoError(t, fSource.Set("limit.qps", 300))
+		b, err := ioutil.ReadFile(runtime)
+		assert.NoError(t, err)
+		assert.Equal(t, "limit:\n  qps: 300\n", string(b))
+		assert.Equal(t, 300, valueOf("limit.qps"))
+	})
+	t.Run("comments of file without keys are kept", func(t *testing.T) {
+		commented := filepath.Join(dir, "commented.yaml")
+		assert.NoError(t, ioutil.WriteFile(commented, []byte("# written by the console\n\n  # do not edit\n"), 0600))
+		assert.NoError(t, fSource.AddFileWithOptions(commented, filesource.WithWritable()))
+		assert.NoError(t, fSource.Set("limit.burst", 20))
+		b, err := ioutil.ReadFile(commented)
+		assert.NoError(t, err)
+		assert.Equal(t, "# written by the console\n\n# do not edit\nlimit:\n  burst: 20\n", string(b))
+	})
+}
+
+// rejectingHandler rejects the batches which have a negative value
+type rejectingHandler struct {
+	lockedHandler
+}
+
+func (h *rejectingHandler) ApplyModuleEvent(events []*event.Event) error {
+	for _, e := range events {
+		if v, ok := e.Value.(int); ok && v < 0 {
+			return fmt.Errorf("negative value of %s", e.Key)
+		}
+	}
+	h.OnModuleEvent(events)
+	return nil
+}
+
+func TestAddRejectedFileAgain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reject")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pool := filepath.Join(dir, "pool.yaml")
+	assert.NoError(t, ioutil.WriteFile(pool, []byte("pool:\n  size: -1\n"), 0600))
+
+	fSource := filesource.NewFileSource()
+	h := &rejectingHandler{}
+	assert.NoError(t, fSource.Watch(h))
+	defer fSource.Cleanup()
+	assert.Error(t, fSource.AddFile(pool, 0, nil))
+	_, err = fSource.GetConfigurationByKey("pool.size")
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(pool, []byte("pool:\n  size: 5\n"), 0600))
+	assert.NoError(t, fSource.AddFile(pool, 0, nil))
+	v, err := fSource.GetConfigurationByKey("pool.size")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, v)
+	assert.Equal(t, 1, h.count(event.Create))
+}
+
+func TestRemoveFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remove")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "base.yaml")
+	assert.NoError(t, ioutil.WriteFile(base, []byte("a: base\nb: base\n"), 0600))
+	plugin := filepath.Join(dir, "plugin.yaml")
+	assert.NoError(t, ioutil.WriteFile(plugin, []byte("a: plugin\nc: plugin\n"), 0600))
+	pluginDir := filepath.Join(dir, "plugins")
+	assert.NoError(t, os.Mkdir(pluginDir, 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(pluginDir, "p.yaml"), []byte("d: p\n"), 0600))
+
+	fSource := filesource.NewFileSource()
+	assert.NoError(t, fSource.AddFile(base, 1, nil))
+	assert.NoError(t, fSource.AddFile(plugin, 0, nil))
+	assert.NoError(t, fSource.AddFile(pluginDir, 0, nil))
+	h := &lockedHandler{}
+	assert.NoError(t, fSource.Watch(h))
+	defer fSource.Cleanup()
+	valueOf := func(key string) interface{} {
+		v, _ := fSource.GetConfigurationByKey(key)
+		return v
+	}
+	assert.Equal(t, "plugin", valueOf("a"))
+
+	t.Run("keys of removed file are updated or deleted", func(t *testing.T) {
+		assert.NoError(t, fSource.RemoveFile(plugin))
+		assert.Equal(t, "base", valueOf("a"))
+		assert.Nil(t, valueOf("c"))
+		assert.Equal(t, 1, h.count(event.Update))
+		assert.Equal(t, 1, h.count(event.Delete))
+	})
+	t.Run("removed file is not watched", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(plugin, []byte("a: again\n"), 0600))
+		time.Sleep(200 * time.Millisecond)
+		assert.Equal(t, "base", valueOf("a"))
+		assert.Equal(t, 1, h.count(event.Update))
+	})
+	t.Run("files of removed directory are removed", func(t *testing.T) {
+		assert.NoError(t, fSource.RemoveFile(pluginDir))
+		assert.Nil(t, valueOf("d"))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(pluginDir, "new.yaml"), []byte("e: new\n"), 0600))
+		time.Sleep(200 * time.Millisecond)
+		assert.Nil(t, valueOf("e"))
+	})
+	t.Run("file not added", func(t *testing.T) {
+		assert.Error(t, fSource.RemoveFile(plugin))
+	})
+}
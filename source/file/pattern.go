@@ -0,0 +1,263 @@
+package filesource
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chassis/go-archaius/source/util"
+)
+
+//Options is options of adding files
+type Options struct {
+	Priority uint32
+	Handler  util.FileHandler
+	// Recursive makes a directory include files of all sub directories
+	Recursive bool
+	// Include and Exclude filter files of directories and globs,
+	// a pattern matches file name or path relative to the directory, "**" matches any directories
+	Include []string
+	Exclude []string
+	// PollInterval makes files polled instead of being watched by fsnotify, 0 means not to poll
+	PollInterval time.Duration
+	// DebounceWindow is the time a file must be quiet after a change before it is reloaded,
+	// 0 means DefaultDebounceWindow
+	DebounceWindow time.Duration
+	// Writable makes the yaml file the target of Set and Delete, it is created if it does not exist
+	Writable bool
+}
+
+//Option is a func
+type Option func(options *Options)
+
+//WithPriority set priority of files, if key conflicts, the file with lower value wins
+func WithPriority(priority uint32) Option {
+	return func(options *Options) {
+		options.Priority = priority
+	}
+}
+
+//WithHandler set handler of files, if it is nil, handler is chosen by file extension
+func WithHandler(handler util.FileHandler) Option {
+	return func(options *Options) {
+		options.Handler = handler
+	}
+}
+
+//WithRecursive includes files of all sub directories of a directory
+func WithRecursive() Option {
+	return func(options *Options) {
+		options.Recursive = true
+	}
+}
+
+//WithPolling polls files at interval instead of watching them by fsnotify,
+//it works on filesystems without inotify, like some network filesystems
+func WithPolling(interval time.Duration) Option {
+	return func(options *Options) {
+		options.PollInterval = interval
+	}
+}
+
+//WithDebounce reloads a file once it is quiet for window after a change,
+//so that the events of one save cause one reload
+func WithDebounce(window time.Duration) Option {
+	return func(options *Options) {
+		options.DebounceWindow = window
+	}
+}
+
+//WithWritable makes Set and Delete of file source write the yaml file, so that changes survive restart.
+//only one file is writable, the file added later replaces the earlier one
+func WithWritable() Option {
+	return func(options *Options) {
+		options.Writable = true
+	}
+}
+
+//WithInclude only includes files matching one of patterns, like "*.yaml"
+func WithInclude(patterns ...string) Option {
+	return func(options *Options) {
+		options.Include = append(options.Include, patterns...)
+	}
+}
+
+//WithExclude skips files matching one of patterns, like "*.bak"
+func WithExclude(patterns ...string) Option {
+	return func(options *Options) {
+		options.Exclude = append(options.Exclude, patterns...)
+	}
+}
+
+// pattern is a directory or glob added to file source, files created in it later are added automatically
+type pattern struct {
+	// path is the directory or glob added
+	path string
+	root string
+	// glob is relative to root and uses "/" as separator
+	glob string
+	// maxDepth is the max number of path parts under root a file can have, -1 means no limit
+	maxDepth int
+	opts     Options
+	// stopPolling stops scanning pattern periodically, it is nil if pattern is not polled
+	stopPolling chan struct{}
+}
+
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// newGlobPattern splits an absolute glob into the directory without wildcards and the rest
+func newGlobPattern(glob string, opts Options) *pattern {
+	parts := strings.Split(filepath.ToSlash(glob), "/")
+	i := 0
+	for i < len(parts)-1 && !isGlob(parts[i]) {
+		i++
+	}
+	pt := &pattern{
+		path:     glob,
+		root:     filepath.FromSlash(strings.Join(parts[:i], "/")),
+		glob:     strings.Join(parts[i:], "/"),
+		maxDepth: len(parts) - i,
+		opts:     opts,
+	}
+	if pt.root == "" {
+		pt.root = string(filepath.Separator)
+	}
+	if strings.Contains(pt.glob, "**") {
+		pt.maxDepth = -1
+	}
+	return pt
+}
+
+func newDirPattern(dir string, opts Options) *pattern {
+	if opts.Recursive {
+		return &pattern{path: dir, root: dir, glob: "**/*", maxDepth: -1, opts: opts}
+	}
+	return &pattern{path: dir, root: dir, glob: "*", maxDepth: 1, opts: opts}
+}
+
+// match reports whether file belongs to pattern
+func (pt *pattern) match(path string) bool {
+	rel, ok := pt.rel(path)
+	if !ok || !matchGlob(pt.glob, rel) || isTempFile(path) {
+		return false
+	}
+	if len(pt.opts.Include) > 0 && !matchAny(pt.opts.Include, rel) {
+		return false
+	}
+	return !matchAny(pt.opts.Exclude, rel)
+}
+
+// wantDir reports whether files of dir may belong to pattern
+func (pt *pattern) wantDir(dir string) bool {
+	rel, ok := pt.rel(dir)
+	if !ok {
+		return false
+	}
+	if rel == "." {
+		return true
+	}
+	depth := len(strings.Split(rel, "/"))
+	if pt.maxDepth >= 0 && depth >= pt.maxDepth {
+		return false
+	}
+	return !matchAny(pt.opts.Exclude, rel)
+}
+
+func (pt *pattern) rel(path string) (string, bool) {
+	rel, err := filepath.Rel(pt.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// scan returns the files and the directories to watch of pattern, sorted by path
+func (pt *pattern) scan() ([]string, []string, error) {
+	files := make([]string, 0)
+	dirs := make([]string, 0)
+	err := filepath.Walk(pt.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == pt.root {
+				return err
+			}
+			// files removed while walking are skipped
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			// symlinked files are included, like files of kubernetes config map
+			if target, err := os.Stat(path); err == nil && target.Mode().IsRegular() {
+				info = target
+			}
+		}
+		if info.IsDir() {
+			if !pt.wantDir(path) {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, path)
+			return nil
+		}
+		if info.Mode().IsRegular() && pt.match(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, dirs, err
+}
+
+//Glob returns the files matching glob, "**" in glob matches any directories
+func Glob(glob string) ([]string, error) {
+	path, err := filepath.Abs(glob)
+	if err != nil {
+		return nil, err
+	}
+	files, _, err := newGlobPattern(path, Options{}).scan()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return files, err
+}
+
+func matchAny(patterns []string, rel string) bool {
+	base := rel[strings.LastIndex(rel, "/")+1:]
+	for _, p := range patterns {
+		if matchGlob(p, rel) || matchGlob(p, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether path matches glob, both of them use "/" as separator
+func matchGlob(glob, path string) bool {
+	return matchParts(strings.Split(glob, "/"), strings.Split(path, "/"))
+}
+
+func matchParts(glob, parts []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchParts(glob[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		ok, err := filepath.Match(glob[0], parts[0])
+		if err != nil || !ok {
+			return false
+		}
+		glob, parts = glob[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// isTempFile reports whether path is a swap or backup file of editors
+func isTempFile(path string) bool {
+	return strings.HasSuffix(path, ".swx") || strings.HasSuffix(path, ".swp") || strings.HasSuffix(path, "~")
+}
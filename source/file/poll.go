@@ -0,0 +1,198 @@
+package filesource
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-chassis/openlog"
+)
+
+//DefaultPollInterval is the interval of polling files when fsnotify does not work
+const DefaultPollInterval = 5 * time.Second
+
+// newWatcher creates the fsnotify watcher, it can be replaced to simulate a filesystem without inotify
+var newWatcher = fsnotify.NewWatcher
+
+// fileStat is the state of a polled file, content is hashed only if mtime or size changes
+type fileStat struct {
+	exist   bool
+	modTime time.Time
+	size    int64
+	hash    []byte
+}
+
+// check returns the current state of file, and whether its content is different from st
+func (st fileStat) check(path string) (fileStat, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}, st.exist
+	}
+	cur := fileStat{exist: true, modTime: info.ModTime(), size: info.Size()}
+	if st.exist && cur.modTime.Equal(st.modTime) && cur.size == st.size {
+		cur.hash = st.hash
+		return cur, false
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		// try again at next poll
+		return st, false
+	}
+	sum := sha256.Sum256(content)
+	cur.hash = sum[:]
+	return cur, !st.exist || !bytes.Equal(cur.hash, st.hash)
+}
+
+// setPollInterval records the polling interval of file, 0 keeps the interval set before
+func (fSource *Source) setPollInterval(filePath string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	fSource.Lock()
+	defer fSource.Unlock()
+	if fSource.pollIntervals == nil {
+		fSource.pollIntervals = make(map[string]time.Duration)
+	}
+	fSource.pollIntervals[filePath] = interval
+}
+
+// interval returns the polling interval of files with options, 0 means they are watched by fsnotify.
+// it must be called with fSource locked
+func (fSource *Source) interval(pollInterval time.Duration) time.Duration {
+	if pollInterval > 0 {
+		return pollInterval
+	}
+	if fSource.watchPool != nil && fSource.watchPool.watcher == nil {
+		return DefaultPollInterval
+	}
+	return 0
+}
+
+// startPolling polls file if it is required and source is watched
+func (fSource *Source) startPolling(filePath string) {
+	fSource.Lock()
+	defer fSource.Unlock()
+	if _, ok := fSource.polling[filePath]; ok || fSource.pollDone == nil {
+		return
+	}
+	interval := fSource.interval(fSource.pollIntervals[filePath])
+	if interval <= 0 {
+		return
+	}
+	if fSource.polling == nil {
+		fSource.polling = make(map[string]chan struct{})
+	}
+	stop := make(chan struct{})
+	fSource.polling[filePath] = stop
+	go fSource.pollFile(filePath, interval, fSource.pollDone, stop)
+}
+
+// startPollingPattern scans a directory or glob periodically if it is required and source is watched
+func (fSource *Source) startPollingPattern(pt *pattern) {
+	fSource.Lock()
+	defer fSource.Unlock()
+	if fSource.pollDone == nil || pt.stopPolling != nil {
+		return
+	}
+	interval := fSource.interval(pt.opts.PollInterval)
+	if interval <= 0 {
+		return
+	}
+	pt.stopPolling = make(chan struct{})
+	go fSource.pollPattern(pt, interval, fSource.pollDone, pt.stopPolling)
+}
+
+// startPollingAll starts polling of files and patterns added before watching
+func (fSource *Source) startPollingAll() {
+	fSource.RLock()
+	paths := make([]string, 0, len(fSource.files))
+	for _, f := range fSource.files {
+		paths = append(paths, f.filePath)
+	}
+	patterns := make([]*pattern, len(fSource.patterns))
+	copy(patterns, fSource.patterns)
+	fSource.RUnlock()
+	for _, p := range paths {
+		fSource.startPolling(p)
+	}
+	for _, pt := range patterns {
+		fSource.startPollingPattern(pt)
+	}
+}
+
+// pollFile checks file at interval, and reloads it like watcher does when its content changes
+// it stops when source is cleaned up or file is removed
+func (fSource *Source) pollFile(filePath string, interval time.Duration, done, stop chan struct{}) {
+	openlog.Info(fmt.Sprintf("poll [%s] every %s", filePath, interval))
+	// file is reloaded at first poll, so that changes made before polling starts are not missed
+	last := fileStat{}
+	// imported files are checked with the file
+	imported := make(map[string]fileStat)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		fSource.RLock()
+		exist := fSource.isFileSrcExist(filePath)
+		fSource.RUnlock()
+		if !exist {
+			return
+		}
+		cur, changed := last.check(filePath)
+		last = cur
+		for _, f := range fSource.importsOf(filePath) {
+			st, importChanged := imported[f].check(f)
+			imported[f] = st
+			changed = changed || importChanged
+		}
+		if !changed {
+			continue
+		}
+		callback := fSource.callback()
+		if callback == nil {
+			return
+		}
+		var err error
+		if cur.exist {
+			err = fSource.reloadFile(callback, filePath)
+		} else {
+			openlog.Warn(fmt.Sprintf("[%s] file is deleted", filePath))
+			err = fSource.deleteFileConfigs(callback, filePath)
+		}
+		if err != nil {
+			openlog.Error(err.Error())
+		}
+	}
+}
+
+// pollPattern scans a directory or glob at interval to add files created in it
+func (fSource *Source) pollPattern(pt *pattern, interval time.Duration, done, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		callback := fSource.callback()
+		if callback == nil {
+			return
+		}
+		if err := fSource.scanPattern(pt, callback); err != nil {
+			openlog.Error(fmt.Sprintf("failed to scan [%s]: %s", pt.root, err))
+		}
+	}
+}
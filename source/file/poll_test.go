@@ -0,0 +1,104 @@
+package filesource
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-chassis/go-archaius/event"
+	"github.com/stretchr/testify/assert"
+)
+
+type countHandler struct {
+	mu     sync.Mutex
+	events int
+}
+
+func (h *countHandler) OnEvent(e *event.Event) {}
+
+func (h *countHandler) OnModuleEvent(events []*event.Event) {
+	h.mu.Lock()
+	h.events += len(events)
+	h.mu.Unlock()
+}
+
+func (h *countHandler) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.events
+}
+
+func TestPollWithoutInotify(t *testing.T) {
+	newWatcher = func() (*fsnotify.Watcher, error) {
+		return nil, errors.New("inotify not supported")
+	}
+	defer func() { newWatcher = fsnotify.NewWatcher }()
+	dir, err := ioutil.TempDir("", "poll")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	app := filepath.Join(dir, "app.yaml")
+	assert.NoError(t, ioutil.WriteFile(app, []byte("a: 1\n"), 0600))
+
+	fSource := NewFileSource()
+	assert.NoError(t, fSource.AddFileWithOptions(app, WithPolling(10*time.Millisecond)))
+	assert.NoError(t, fSource.AddFileWithOptions(filepath.Join(dir, "conf", "*.yaml"),
+		WithPolling(10*time.Millisecond)))
+	h := &countHandler{}
+	assert.NoError(t, fSource.Watch(h))
+	defer fSource.Cleanup()
+	valueOf := func(key string) interface{} {
+		v, _ := fSource.GetConfigurationByKey(key)
+		return v
+	}
+
+	t.Run("change", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(app, []byte("a: 2\n"), 0600))
+		assert.Eventually(t, func() bool { return valueOf("a") == 2 }, 3*time.Second, 10*time.Millisecond)
+	})
+	t.Run("same content", func(t *testing.T) {
+		before := h.count()
+		later := time.Now().Add(time.Second)
+		assert.NoError(t, os.Chtimes(app, later, later))
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, before, h.count())
+	})
+	t.Run("new file of glob", func(t *testing.T) {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, "conf"), 0700))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "conf", "b.yaml"), []byte("b: 1\n"), 0600))
+		assert.Eventually(t, func() bool { return valueOf("b") == 1 }, 3*time.Second, 10*time.Millisecond)
+	})
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, os.Remove(app))
+		assert.Eventually(t, func() bool { return valueOf("a") == nil }, 3*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestFileStat_check(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stat")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "a.yaml")
+
+	st, changed := fileStat{}.check(f)
+	assert.False(t, changed)
+	assert.False(t, st.exist)
+
+	assert.NoError(t, ioutil.WriteFile(f, []byte("a: 1\n"), 0600))
+	st, changed = st.check(f)
+	assert.True(t, changed)
+
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(f, later, later))
+	st, changed = st.check(f)
+	assert.False(t, changed)
+
+	assert.NoError(t, ioutil.WriteFile(f, []byte("a: 2\n"), 0600))
+	assert.NoError(t, os.Chtimes(f, later.Add(time.Second), later.Add(time.Second)))
+	_, changed = st.check(f)
+	assert.True(t, changed)
+}
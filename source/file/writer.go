@@ -0,0 +1,215 @@
+package filesource
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//Set writes key value into the writable file, it does nothing if there is no writable file.
+//comments and order of the file are kept, and listeners receive the change once
+func (fSource *Source) Set(key string, value interface{}) error {
+	var n yaml.Node
+	if err := n.Encode(value); err != nil {
+		return fmt.Errorf("can not write value of [%s]: %s", key, err)
+	}
+	return fSource.write(func(root *yaml.Node) bool {
+		setNode(root, strings.Split(key, "."), &n)
+		return true
+	})
+}
+
+//Delete removes key from the writable file, it does nothing if there is no writable file
+func (fSource *Source) Delete(key string) error {
+	return fSource.write(func(root *yaml.Node) bool {
+		return deleteNode(root, strings.Split(key, "."))
+	})
+}
+
+// addWritableFile adds the target of Set and Delete, it is created if it does not exist
+func (fSource *Source) addWritableFile(path string, o Options) error {
+	if isGlob(path) {
+		return fmt.Errorf("writable file [%s] can not be a glob", path)
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if fileType(f) != RegularFile {
+		return fmt.Errorf("writable file [%s] must be a regular file", path)
+	}
+	fSource.RLock()
+	exist := fSource.isFileSrcExist(path)
+	fSource.RUnlock()
+	if !exist {
+		if err := fSource.handleFile(f, o, fSource.callback()); err != nil {
+			return err
+		}
+		fSource.watchDir(filepath.Dir(path))
+	}
+	fSource.Lock()
+	fSource.writableFile = path
+	fSource.Unlock()
+	return nil
+}
+
+// write changes the yaml nodes of writable file, saves it atomically and applies the change,
+// the file is restored if the change is rejected
+func (fSource *Source) write(change func(root *yaml.Node) bool) error {
+	fSource.writeMux.Lock()
+	defer fSource.writeMux.Unlock()
+	fSource.RLock()
+	filePath := fSource.writableFile
+	fSource.RUnlock()
+	if filePath == "" {
+		return nil
+	}
+
+	old, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(old, &doc); err != nil {
+		return fmt.Errorf("can not write [%s]: %s", filePath, err)
+	}
+	if doc.Kind == 0 {
+		// a file of only comments has no node to keep them, they are put above the first key
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{
+			{Kind: yaml.MappingNode, Tag: "!!map", HeadComment: comments(old)}}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("can not write [%s]: content is not a map", filePath)
+	}
+	if !change(doc.Content[0]) {
+		return nil
+	}
+	buf := bytes.NewBuffer(nil)
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	if err := writeAtomically(filePath, buf.Bytes()); err != nil {
+		return err
+	}
+	if err := fSource.loadContent(fSource.callback(), filePath, buf.Bytes()); err != nil {
+		if restoreErr := writeAtomically(filePath, old); restoreErr != nil {
+			return fmt.Errorf("%s, and failed to restore [%s]: %s", err, filePath, restoreErr)
+		}
+		fSource.setContentHash(filePath, old)
+		return err
+	}
+	return nil
+}
+
+// comments returns the comment lines of content which has nothing else, blank lines between them are kept
+func comments(content []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeAtomically writes a temp file in the same directory and renames it to filePath,
+// so that readers never see a partial file
+func writeAtomically(filePath string, content []byte) error {
+	if target, err := filepath.EvalSymlinks(filePath); err == nil {
+		filePath = target
+	}
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(filePath); err == nil {
+		mode = info.Mode()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// findKey returns the index of the value of a key in mapping, or -1
+func findKey(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// setNode sets the value of a dotted key, an existing key like "a.b" is used as it is,
+// otherwise nested maps are used or created
+func setNode(mapping *yaml.Node, parts []string, value *yaml.Node) {
+	if i := findKey(mapping, strings.Join(parts, ".")); i >= 0 {
+		old := mapping.Content[i]
+		value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+		mapping.Content[i] = value
+		return
+	}
+	if len(parts) > 1 {
+		if i := findKey(mapping, parts[0]); i >= 0 && mapping.Content[i].Kind == yaml.MappingNode {
+			setNode(mapping.Content[i], parts[1:], value)
+			return
+		}
+	}
+	for j := len(parts) - 1; j > 0; j-- {
+		value = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: parts[j]}, value}}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: parts[0]}, value)
+}
+
+// deleteNode deletes a dotted key, maps become empty are deleted too. it returns false if key does not exist
+func deleteNode(mapping *yaml.Node, parts []string) bool {
+	if i := findKey(mapping, strings.Join(parts, ".")); i >= 0 {
+		removeKey(mapping, i)
+		return true
+	}
+	if len(parts) < 2 {
+		return false
+	}
+	i := findKey(mapping, parts[0])
+	if i < 0 || mapping.Content[i].Kind != yaml.MappingNode {
+		return false
+	}
+	if !deleteNode(mapping.Content[i], parts[1:]) {
+		return false
+	}
+	if len(mapping.Content[i].Content) == 0 {
+		removeKey(mapping, i)
+	}
+	return true
+}
+
+// removeKey removes the key of value i from mapping, the comment above the key is kept for the next key
+func removeKey(mapping *yaml.Node, i int) {
+	key := mapping.Content[i-1]
+	if key.HeadComment != "" && i+1 < len(mapping.Content) {
+		next := mapping.Content[i+1]
+		next.HeadComment = strings.TrimSuffix(key.HeadComment+"\n"+next.HeadComment, "\n")
+	}
+	mapping.Content = append(mapping.Content[:i-1], mapping.Content[i+1:]...)
+}
@@ -22,12 +22,15 @@
 package source
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"gopkg.in/yaml.v3"
 	"io"
 	"reflect"
 	"regexp"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/go-chassis/go-archaius/event"
@@ -57,14 +60,45 @@ type Manager struct {
 
 	ConfigurationMap sync.Map
 
-	dispatcher *event.Dispatcher
+	// eventMux makes validating, applying and dispatching a batch of events atomic
+	eventMux     sync.Mutex
+	dispatcher   *event.Dispatcher
+	syncDispatch bool
+
+	statusMux sync.RWMutex
+	status    map[string]*Status
+
+	// published are the values of sources which are not Reloader as listeners last received them,
+	// Refresh compares them with the values of source to find changes
+	publishedMux sync.Mutex
+	published    map[string]map[string]interface{}
+}
+
+// ManagerOption is a func
+type ManagerOption func(m *Manager)
+
+// WithSyncDispatch makes listeners receive events before the change which generates them returns,
+// events are delivered on the goroutine which applies the change
+func WithSyncDispatch() ManagerOption {
+	return func(m *Manager) {
+		m.syncDispatch = true
+	}
 }
 
 // NewManager creates an object of Manager
-func NewManager() *Manager {
+func NewManager(opts ...ManagerOption) *Manager {
 	configMgr := new(Manager)
-	configMgr.dispatcher = event.NewDispatcher()
+	for _, opt := range opts {
+		opt(configMgr)
+	}
+	dispatcherOpts := []event.DispatcherOption{event.WithStateLoader(configMgr.stateEvents)}
+	if configMgr.syncDispatch {
+		dispatcherOpts = append(dispatcherOpts, event.WithSyncDelivery())
+	}
+	configMgr.dispatcher = event.NewDispatcher(dispatcherOpts...)
 	configMgr.Sources = make(map[string]ConfigSource)
+	configMgr.status = make(map[string]*Status)
+	configMgr.published = make(map[string]map[string]interface{})
 	return configMgr
 }
 
@@ -79,6 +113,9 @@ func (m *Manager) Cleanup() error {
 			return err
 		}
 	}
+	m.publishedMux.Lock()
+	m.published = make(map[string]map[string]interface{})
+	m.publishedMux.Unlock()
 	return nil
 }
 
@@ -137,8 +174,16 @@ func (m *Manager) Marshal(w io.Writer) error {
 		openlog.Error("invalid writer")
 		return ErrWriterInvalid
 	}
-	allConfig := make(map[string]map[string]interface{})
-	for name, source := range m.Sources {
+	m.sourceMapMux.RLock()
+	names := make([]string, 0, len(m.Sources))
+	for name := range m.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// each source is a mapping, keys located by source are commented with where they come from
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, name := range names {
+		source := m.Sources[name]
 		config, err := source.GetConfigurations()
 		if err != nil {
 			openlog.Error("get source " + name + " error " + err.Error())
@@ -147,10 +192,43 @@ func (m *Manager) Marshal(w io.Writer) error {
 		if len(config) == 0 {
 			continue
 		}
-		allConfig[name] = config
+		node, err := configNode(source, config)
+		if err != nil {
+			m.sourceMapMux.RUnlock()
+			return err
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, node)
 	}
+	m.sourceMapMux.RUnlock()
 	encode := yaml.NewEncoder(w)
-	return encode.Encode(allConfig)
+	return encode.Encode(doc)
+}
+
+func configNode(source ConfigSource, config map[string]interface{}) (*yaml.Node, error) {
+	locator, _ := source.(KeyLocator)
+	redactor, _ := source.(Redactor)
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range keys {
+		value := &yaml.Node{}
+		if redactor != nil && redactor.Redact(key) {
+			value = &yaml.Node{Kind: yaml.ScalarNode, Value: RedactedValue}
+		} else if err := value.Encode(config[key]); err != nil {
+			return nil, err
+		}
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Value: key}
+		if locator != nil {
+			if location, ok := locator.KeyLocation(key); ok {
+				keyNode.LineComment = "from " + location
+			}
+		}
+		node.Content = append(node.Content, keyNode, value)
+	}
+	return node, nil
 }
 
 // AddSource adds a source to configurationManager
@@ -203,14 +281,27 @@ func (m *Manager) pullSourceConfigs(source string) error {
 		}
 
 		openlog.Warn(fmt.Sprintf("empty config from %s", source))
+		m.seedPublished(configSource, config)
 		return nil
 	}
 
 	m.updateConfigurationMap(configSource, config)
+	m.seedPublished(configSource, config)
 
 	return nil
 }
 
+// seedPublished records the values of a source which is not Reloader when it is pulled
+func (m *Manager) seedPublished(s ConfigSource, config map[string]interface{}) {
+	if _, ok := s.(Reloader); ok {
+		return
+	}
+	values := sourceValues(s, config)
+	m.publishedMux.Lock()
+	m.published[s.GetSourceName()] = values
+	m.publishedMux.Unlock()
+}
+
 // Configs returns all the key values
 func (m *Manager) Configs() map[string]interface{} {
 	config := make(map[string]interface{}, 0)
@@ -232,6 +323,7 @@ func (m *Manager) Configs() map[string]interface{} {
 // map[string]interface{}{
 // 		key string: map[string]interface{"value": value, "source": sourceName}
 // }
+// if the source knows where the value comes from, like file source, it is given by "location"
 func (m *Manager) ConfigsWithSourceNames() map[string]interface{} {
 	config := make(map[string]interface{}, 0)
 
@@ -241,12 +333,51 @@ func (m *Manager) ConfigsWithSourceNames() map[string]interface{} {
 			return true
 		}
 		// each key stores its value and source name
-		config[key.(string)] = map[string]interface{}{"value": sValue, "source": value}
+		item := map[string]interface{}{"value": sValue, "source": value}
+		if location, ok := m.keyLocation(key.(string), value.(string)); ok {
+			item["location"] = location
+		}
+		config[key.(string)] = item
 		return true
 	})
 	return config
 }
 
+// keyLocation asks the source where the value of key comes from
+func (m *Manager) keyLocation(key, sourceName string) (string, bool) {
+	m.sourceMapMux.RLock()
+	source, ok := m.Sources[sourceName]
+	m.sourceMapMux.RUnlock()
+	if !ok {
+		return "", false
+	}
+	locator, ok := source.(KeyLocator)
+	if !ok {
+		return "", false
+	}
+	return locator.KeyLocation(key)
+}
+
+// stateEvents returns all the key values as events, it is the state replayed to new listeners
+func (m *Manager) stateEvents() []*event.Event {
+	events := make([]*event.Event, 0)
+	m.ConfigurationMap.Range(func(key, value interface{}) bool {
+		sValue := m.configValueBySource(key.(string), value.(string))
+		if sValue == nil {
+			return true
+		}
+		events = append(events, &event.Event{
+			EventSource: value.(string),
+			EventType:   event.Create,
+			Key:         key.(string),
+			Value:       sValue,
+			HasUpdated:  true,
+		})
+		return true
+	})
+	return events
+}
+
 // AddDimensionInfo adds the dimensionInfo to the list of which configurations needs to be pulled
 func (m *Manager) AddDimensionInfo(labels map[string]string) (map[string]string, error) {
 	config := make(map[string]string, 0)
@@ -260,15 +391,136 @@ func (m *Manager) AddDimensionInfo(labels map[string]string) (map[string]string,
 	return config, nil
 }
 
-// Refresh reload the configurations of a source
+// Refresh reload the configurations of a source, keys the source does not have any more are deleted.
+// for a source which is not Reloader, its values are compared with the ones listeners last received,
+// and the changes are applied as events
 func (m *Manager) Refresh(sourceName string) error {
+	m.sourceMapMux.RLock()
+	s, ok := m.Sources[sourceName]
+	m.sourceMapMux.RUnlock()
+	if r, isReloader := s.(Reloader); ok && isReloader {
+		if err := r.Reload(m); err != nil {
+			openlog.Error(fmt.Sprintf("reload %s source failed: %s", sourceName, err))
+			return fmt.Errorf("fail to reload %s source: %s", sourceName, err)
+		}
+	} else if ok {
+		if err := m.pullChanges(s); err != nil {
+			openlog.Error(fmt.Sprintf(fmtLoadConfigFailed, sourceName, err))
+			return fmt.Errorf("fail to load configuration of %s source: %s", sourceName, err)
+		}
+		return m.prune(sourceName)
+	}
 	err := m.pullSourceConfigs(sourceName)
 	if err != nil {
 		openlog.Error(fmt.Sprintf(fmtLoadConfigFailed, sourceName, err))
 		errorMsg := "fail to load configuration of" + sourceName + " source"
 		return errors.New(errorMsg)
 	}
-	return nil
+	return m.prune(sourceName)
+}
+
+// pullChanges applies the keys which source has but listeners did not receive, and the values changed, as events,
+// so that listeners receive them and validators can reject them.
+// keys provided by sources with higher priority are only recorded
+func (m *Manager) pullChanges(s ConfigSource) error {
+	config, err := s.GetConfigurations()
+	if err != nil {
+		return err
+	}
+	values := sourceValues(s, config)
+	sourceName := s.GetSourceName()
+	events := make([]*event.Event, 0)
+	m.publishedMux.Lock()
+	published := m.published[sourceName]
+	if published == nil {
+		published = make(map[string]interface{})
+		m.published[sourceName] = published
+	}
+	for key, value := range values {
+		old, ok := published[key]
+		if ok && reflect.DeepEqual(old, value) {
+			continue
+		}
+		if owner, exist := m.ConfigurationMap.Load(key); exist && owner != sourceName {
+			high := m.getHighPrioritySource(owner.(string), sourceName)
+			if high != nil && high.GetSourceName() == owner {
+				published[key] = value
+				continue
+			}
+		}
+		eventType := event.Update
+		if !ok {
+			eventType = event.Create
+		}
+		events = append(events, &event.Event{EventSource: sourceName, EventType: eventType, Key: key, Value: value})
+	}
+	m.publishedMux.Unlock()
+	if len(events) == 0 {
+		return nil
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return m.ApplyModuleEvent(events)
+}
+
+// sourceValues returns the values of keys in config, which is returned by GetConfigurations of source
+func sourceValues(s ConfigSource, config map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{}, len(config))
+	for key := range config {
+		if value, err := s.GetConfigurationByKey(key); err == nil && value != nil {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// publish records the values of es from sources which are not Reloader, they are received by listeners
+func (m *Manager) publish(es []*event.Event) {
+	m.publishedMux.Lock()
+	defer m.publishedMux.Unlock()
+	for _, e := range es {
+		if e == nil || e.HasUpdated {
+			continue
+		}
+		published, ok := m.published[e.EventSource]
+		if !ok {
+			continue
+		}
+		if e.EventType == event.Delete {
+			delete(published, e.Key)
+			continue
+		}
+		published[e.Key] = e.Value
+	}
+}
+
+// prune deletes the keys which come from source but it does not have any more,
+// like keys of a file removed before file source is watched
+func (m *Manager) prune(sourceName string) error {
+	m.sourceMapMux.RLock()
+	s, ok := m.Sources[sourceName]
+	m.sourceMapMux.RUnlock()
+	if !ok {
+		return nil
+	}
+	events := make([]*event.Event, 0)
+	m.ConfigurationMap.Range(func(key, value interface{}) bool {
+		if value != sourceName {
+			return true
+		}
+		if v, err := s.GetConfigurationByKey(key.(string)); err != nil || v == nil {
+			events = append(events, &event.Event{EventSource: sourceName, EventType: event.Delete, Key: key.(string)})
+		}
+		return true
+	})
+	if len(events) == 0 {
+		return nil
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return m.ApplyRemovalEvent(events)
 }
 
 func (m *Manager) configValueBySource(configKey, sourceName string) interface{} {
@@ -374,21 +626,50 @@ func (m *Manager) updateConfigurationMapByDI(source ConfigSource, configs map[st
 	return nil
 }
 
-func (m *Manager) updateModuleEvent(es []*event.Event) error {
+// updateModuleEvent validates es if validate is true, calls commit, then applies and dispatches es
+func (m *Manager) updateModuleEvent(es []*event.Event, commit func(), validate bool) error {
 	if es == nil || len(es) == 0 {
+		if commit != nil {
+			commit()
+		}
 		return errors.New("nil or invalid events supplied")
 	}
 
-	var validEvents []*event.Event
+	// deferred calls run in reverse order, events are delivered after eventMux is released
+	defer m.drain()
+	m.eventMux.Lock()
+	defer m.eventMux.Unlock()
+	// events already applied by OnEvent are not validated again
+	pending := make([]*event.Event, 0, len(es))
+	for _, e := range es {
+		if e != nil && !e.HasUpdated {
+			pending = append(pending, e)
+		}
+	}
+	if validate {
+		if err := m.validate(pending); err != nil {
+			return err
+		}
+	}
+	if commit != nil {
+		commit()
+	}
+	m.publish(es)
+
+	var validEvents, freshEvents []*event.Event
 	for i := 0; i < len(es); i++ {
+		fresh := es[i] != nil && !es[i].HasUpdated
 		err := m.updateEvent(es[i])
 		if err != nil {
-			if err != ErrKeyNotExist {
-				openlog.Error(fmt.Sprintf("%dth event %+v got error:%v", i, *es[i], err))
+			if err != ErrKeyNotExist && err != ErrIgnoreChange {
+				openlog.Error(fmt.Sprintf("%dth event %s got error:%v", i, m.eventString(es[i]), err))
 			}
 			continue
 		}
 		validEvents = append(validEvents, es[i])
+		if fresh {
+			freshEvents = append(freshEvents, es[i])
+		}
 	}
 
 	if len(validEvents) == 0 {
@@ -396,16 +677,98 @@ func (m *Manager) updateModuleEvent(es []*event.Event) error {
 		return nil
 	}
 
+	// listeners of single key only receive the events which are not delivered by OnEvent
+	for _, e := range freshEvents {
+		m.dispatcher.DispatchEvent(e)
+	}
 	return m.dispatcher.DispatchModuleEvent(validEvents)
 }
 
+// drain delivers queued events on current goroutine in sync dispatch mode,
+// it must not be called with eventMux held, listeners may change configurations in callback
+func (m *Manager) drain() {
+	if m.syncDispatch {
+		m.dispatcher.Drain()
+	}
+}
+
+// Revision returns the revision of the latest dispatched change
+func (m *Manager) Revision() uint64 {
+	return m.dispatcher.Revision()
+}
+
+// WaitForRevision blocks until changes up to rev are delivered to all listeners
+func (m *Manager) WaitForRevision(ctx context.Context, rev uint64) error {
+	return m.dispatcher.WaitForRevision(ctx, rev)
+}
+
+// Flush applies the changes sources have not noticed yet,
+// then blocks until all changes applied so far are delivered to all listeners
+func (m *Manager) Flush(ctx context.Context) error {
+	m.sourceMapMux.RLock()
+	flushers := make([]Flusher, 0, len(m.Sources))
+	for _, s := range m.Sources {
+		if f, ok := s.(Flusher); ok {
+			flushers = append(flushers, f)
+		}
+	}
+	m.sourceMapMux.RUnlock()
+	for _, f := range flushers {
+		if err := f.Flush(m); err != nil {
+			return err
+		}
+	}
+	return m.WaitForRevision(ctx, m.Revision())
+}
+
+// ReloadAll refreshes all sources one by one, sources which are Reloader read their configs again,
+// and the changes are applied as events. then it blocks until the changes are delivered to all listeners,
+// or ctx is done. the errors of all sources are returned together
+func (m *Manager) ReloadAll(ctx context.Context) error {
+	m.sourceMapMux.RLock()
+	names := make([]string, 0, len(m.Sources))
+	for name := range m.Sources {
+		names = append(names, name)
+	}
+	m.sourceMapMux.RUnlock()
+	sort.Strings(names)
+
+	msgs := make([]string, 0)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := m.Refresh(name); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if err := m.WaitForRevision(ctx, m.Revision()); err != nil {
+		return err
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("reload failed: %s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+func (m *Manager) validate(es []*event.Event) error {
+	if len(es) == 0 {
+		return nil
+	}
+	err := m.dispatcher.Validate(es)
+	if err != nil {
+		m.recordRejection(es, err)
+	}
+	return err
+}
+
 func (m *Manager) updateEvent(e *event.Event) error {
 	// refresh all configuration one by one
 	if e == nil || e.EventSource == "" || e.Key == "" {
 		return errors.New("nil or invalid event supplied")
 	}
 	if e.HasUpdated {
-		openlog.Debug(fmt.Sprintf("config update event %+v has been updated", *e))
+		openlog.Debug(fmt.Sprintf("config update event %s has been updated", m.eventString(e)))
 		return nil
 	}
 	openlog.Info("config update event received")
@@ -442,7 +805,12 @@ func (m *Manager) updateEvent(e *event.Event) error {
 			if source == nil {
 				m.ConfigurationMap.Delete(e.Key)
 			} else {
+				// key is still provided by another source, listeners get its value
 				m.ConfigurationMap.Store(e.Key, source.GetSourceName())
+				if value, err := source.GetConfigurationByKey(e.Key); err == nil {
+					e.EventType = event.Update
+					e.Value = value
+				}
 			}
 		}
 
@@ -452,9 +820,33 @@ func (m *Manager) updateEvent(e *event.Event) error {
 	return nil
 }
 
+// eventString formats e for logs, values of events from Redactor sources are left out
+func (m *Manager) eventString(e *event.Event) string {
+	if e == nil {
+		return "<nil>"
+	}
+	m.sourceMapMux.RLock()
+	s := m.Sources[e.EventSource]
+	m.sourceMapMux.RUnlock()
+	if _, ok := s.(Redactor); ok {
+		return fmt.Sprintf("{EventSource:%s EventType:%s Key:%s}", e.EventSource, e.EventType, e.Key)
+	}
+	return fmt.Sprintf("%+v", *e)
+}
+
 // OnEvent Triggers actions when an event is generated
-func (m *Manager) OnEvent(event *event.Event) {
-	err := m.updateEvent(event)
+func (m *Manager) OnEvent(e *event.Event) {
+	defer m.drain()
+	m.eventMux.Lock()
+	defer m.eventMux.Unlock()
+	if e != nil && !e.HasUpdated {
+		if err := m.validate([]*event.Event{e}); err != nil {
+			openlog.Error("event rejected: " + err.Error())
+			return
+		}
+		m.publish([]*event.Event{e})
+	}
+	err := m.updateEvent(e)
 	if err != nil {
 		if err != ErrIgnoreChange {
 			openlog.Error("failed in updating event with error: " + err.Error())
@@ -462,16 +854,34 @@ func (m *Manager) OnEvent(event *event.Event) {
 		return
 	}
 
-	m.dispatcher.DispatchEvent(event)
+	m.dispatcher.DispatchEvent(e)
 }
 
 // OnModuleEvent Triggers actions when events are generated
-func (m *Manager) OnModuleEvent(event []*event.Event) {
-	if err := m.updateModuleEvent(event); err != nil {
+func (m *Manager) OnModuleEvent(events []*event.Event) {
+	if err := m.updateModuleEvent(events, nil, true); err != nil {
 		openlog.Error("failed in updating events with error: " + err.Error())
 	}
 }
 
+// ApplyModuleEvent validates events as one batch, then applies and dispatches them.
+// if any validator rejects the batch, nothing is applied and the rejection is returned
+func (m *Manager) ApplyModuleEvent(events []*event.Event) error {
+	return m.updateModuleEvent(events, nil, true)
+}
+
+// CommitModuleEvent validates events, then calls commit to publish the new state of source and applies events,
+// commit is not called if events are rejected, so that listeners and readers never see rejected values
+func (m *Manager) CommitModuleEvent(events []*event.Event, commit func()) error {
+	return m.updateModuleEvent(events, commit, true)
+}
+
+// ApplyRemovalEvent applies and dispatches events caused by removing a part of a source, like a file,
+// validators are not consulted, because the source does not have the removed configs any more
+func (m *Manager) ApplyRemovalEvent(events []*event.Event) error {
+	return m.updateModuleEvent(events, nil, false)
+}
+
 func (m *Manager) findNextBestSource(key string, sourceName string) ConfigSource {
 	var rSource ConfigSource
 	m.sourceMapMux.RLock()
@@ -519,6 +929,12 @@ func (m *Manager) getHighPrioritySource(srcNameA, srcNameB string) ConfigSource
 
 // RegisterListener Function to Register all listener for different key changes
 func (m *Manager) RegisterListener(listenerObj event.Listener, keys ...string) error {
+	return m.RegisterListenerWithOptions(listenerObj, keys)
+}
+
+// RegisterListenerWithOptions Function to Register listener for different key changes with options
+func (m *Manager) RegisterListenerWithOptions(listenerObj event.Listener, keys []string,
+	opts ...event.RegisterOption) error {
 	for _, key := range keys {
 		_, err := regexp.Compile(key)
 		if err != nil {
@@ -527,7 +943,11 @@ func (m *Manager) RegisterListener(listenerObj event.Listener, keys ...string) e
 		}
 	}
 
-	return m.dispatcher.RegisterListener(listenerObj, keys...)
+	// no event can be applied during registration, so that replayed state is consistent with later updates
+	defer m.drain()
+	m.eventMux.Lock()
+	defer m.eventMux.Unlock()
+	return m.dispatcher.RegisterListenerWithOptions(listenerObj, keys, opts...)
 }
 
 // UnRegisterListener remove listener
@@ -545,6 +965,27 @@ func (m *Manager) UnRegisterListener(listenerObj event.Listener, keys ...string)
 
 // RegisterModuleListener Function to Register all moduleListener for different key(prefix) changes
 func (m *Manager) RegisterModuleListener(listenerObj event.ModuleListener, prefixes ...string) error {
+	return m.RegisterModuleListenerWithOptions(listenerObj, prefixes)
+}
+
+// RegisterModuleListenerWithOptions Function to Register moduleListener for different key(prefix) changes with options
+func (m *Manager) RegisterModuleListenerWithOptions(listenerObj event.ModuleListener, prefixes []string,
+	opts ...event.RegisterOption) error {
+	for _, prefix := range prefixes {
+		if prefix == "" {
+			openlog.Error(fmt.Sprintf(fmtInvalidKey, prefix))
+			return fmt.Errorf(fmtInvalidKey, prefix)
+		}
+	}
+
+	defer m.drain()
+	m.eventMux.Lock()
+	defer m.eventMux.Unlock()
+	return m.dispatcher.RegisterModuleListenerWithOptions(listenerObj, prefixes, opts...)
+}
+
+// RegisterModuleValidator registers validator for different key(prefix) changes
+func (m *Manager) RegisterModuleValidator(validator event.ModuleValidator, prefixes ...string) error {
 	for _, prefix := range prefixes {
 		if prefix == "" {
 			openlog.Error(fmt.Sprintf(fmtInvalidKey, prefix))
@@ -552,7 +993,22 @@ func (m *Manager) RegisterModuleListener(listenerObj event.ModuleListener, prefi
 		}
 	}
 
-	return m.dispatcher.RegisterModuleListener(listenerObj, prefixes...)
+	return m.dispatcher.RegisterModuleValidator(validator, prefixes...)
+}
+
+// UnRegisterModuleValidator remove validator
+func (m *Manager) UnRegisterModuleValidator(validator event.ModuleValidator, prefixes ...string) error {
+	return m.dispatcher.UnRegisterModuleValidator(validator, prefixes...)
+}
+
+// RegisterErrorListener registers listener for errors of sources, like a config file with syntax error
+func (m *Manager) RegisterErrorListener(listenerObj event.ErrorListener) error {
+	return m.dispatcher.RegisterErrorListener(listenerObj)
+}
+
+// UnRegisterErrorListener remove error listener
+func (m *Manager) UnRegisterErrorListener(listenerObj event.ErrorListener) error {
+	return m.dispatcher.UnRegisterErrorListener(listenerObj)
 }
 
 // UnRegisterModuleListener remove moduleListener
@@ -120,20 +120,28 @@ func (ms *Source) Set(key string, value interface{}) error {
 	e.Key = key
 	e.Value = value
 
-	if _, ok := ms.Configs.Load(key); !ok {
+	old, exist := ms.Configs.Load(key)
+	if !exist {
 		e.EventType = event.Create
 	} else {
 		e.EventType = event.Update
 	}
 
-	ms.Configs.Store(key, value)
-
-	if ms.callback != nil {
-		ms.callback.OnEvent(e)
-		ms.callback.OnModuleEvent([]*event.Event{e})
+	commit := func() {
+		ms.Configs.Store(key, value)
 	}
-
-	return nil
+	if ms.callback == nil {
+		commit()
+		return nil
+	}
+	// the value is stored only if the change is accepted
+	return source.CommitModuleEvent(ms.callback, []*event.Event{e}, commit, func() {
+		if exist {
+			ms.Configs.Store(key, old)
+		} else {
+			ms.Configs.Delete(key)
+		}
+	})
 }
 
 //Delete remvove mem config
@@ -146,17 +154,20 @@ func (ms *Source) Delete(key string) error {
 	e.EventSource = ms.GetSourceName()
 	e.Key = key
 
-	if v, ok := ms.Configs.Load(key); ok {
-		e.EventType = event.Delete
-		e.Value = v
-	} else {
+	v, ok := ms.Configs.Load(key)
+	if !ok {
 		return nil
 	}
-
-	if ms.callback != nil {
-		ms.callback.OnEvent(e)
-		ms.callback.OnModuleEvent([]*event.Event{e})
+	e.EventType = event.Delete
+	e.Value = v
+	commit := func() {
+		ms.Configs.Delete(key)
 	}
-
-	return nil
+	if ms.callback == nil {
+		commit()
+		return nil
+	}
+	return source.CommitModuleEvent(ms.callback, []*event.Event{e}, commit, func() {
+		ms.Configs.Store(key, v)
+	})
 }
@@ -45,6 +45,7 @@ type Source struct {
 
 	sync.RWMutex
 	currentConfig map[string]interface{}
+	updateMux     sync.Mutex
 
 	dimensionsInfoConfiguration  map[string]map[string]interface{}
 	dimensionsInfoConfigurations []map[string]map[string]interface{}
@@ -54,6 +55,9 @@ type Source struct {
 	priority        int
 
 	eh source.EventHandler
+	// pulled tells configs are pulled by GetConfigurations, periodic starts refreshing once
+	pulled   bool
+	periodic sync.Once
 }
 
 //NewConfigCenterSource initializes all components of configuration center
@@ -81,23 +85,33 @@ func NewConfigCenterSource(ci *archaius.RemoteInfo) (source.ConfigSource, error)
 	return s, nil
 }
 
-//GetConfigurations pull config from remote and start refresh configs interval
+//GetConfigurations pull config from remote and start refresh configs interval at the first time,
+//later it returns the configs pulled last, Reload pulls them again.
 // write a new map and return, internal map can not be operated outside struct
 func (rs *Source) GetConfigurations() (map[string]interface{}, error) {
 	configMap := make(map[string]interface{})
-	err := rs.refreshConfigurations()
-	if err != nil {
-		return nil, err
+	rs.RLock()
+	pulled := rs.pulled
+	rs.RUnlock()
+	if !pulled {
+		if err := rs.refreshConfigurations(rs.eh); err != nil {
+			return nil, err
+		}
+		rs.Lock()
+		rs.pulled = true
+		rs.Unlock()
 	}
 	if rs.RefreshMode == remote.ModeInterval {
-		go rs.refreshConfigurationsPeriodically()
+		rs.periodic.Do(func() {
+			go rs.refreshConfigurationsPeriodically()
+		})
 	}
 
-	rs.Lock()
+	rs.RLock()
 	for key, value := range rs.currentConfig {
 		configMap[key] = value
 	}
-	rs.Unlock()
+	rs.RUnlock()
 
 	return configMap, nil
 }
@@ -105,21 +119,20 @@ func (rs *Source) GetConfigurations() (map[string]interface{}, error) {
 func (rs *Source) refreshConfigurationsPeriodically() {
 	ticker := time.Tick(rs.RefreshInterval)
 	for range ticker {
-		err := rs.refreshConfigurations()
+		err := rs.refreshConfigurations(rs.eh)
 		if err != nil {
 			openlog.Error("can not pull configs: " + err.Error())
 		}
 	}
 }
 
-func (rs *Source) refreshConfigurations() error {
-	var (
-		config map[string]interface{}
-		err    error
-		events []*event.Event
-	)
+//Reload pulls configs from remote immediately, and applies the changes to handler
+func (rs *Source) Reload(handler source.EventHandler) error {
+	return rs.refreshConfigurations(handler)
+}
 
-	config, err = rs.c.PullConfigs(rs.dimensions...)
+func (rs *Source) refreshConfigurations(handler source.EventHandler) error {
+	config, err := rs.c.PullConfigs(rs.dimensions...)
 	if err != nil {
 		openlog.Warn(fmt.Sprintf("failed to pull configurations from config center server %s", err)) //Warn
 		return err
@@ -127,23 +140,48 @@ func (rs *Source) refreshConfigurations() error {
 	openlog.Debug("pull configs", openlog.WithTags(openlog.Tags{
 		"config": config,
 	}))
+	return rs.updateConfig(handler, config)
+}
+
+func (rs *Source) updateConfigAndFireEvent(config map[string]interface{}) error {
+	return rs.updateConfig(rs.eh, config)
+}
+
+// updateConfig applies the changes of config to handler, config replaces current config only if they are accepted
+func (rs *Source) updateConfig(handler source.EventHandler, config map[string]interface{}) error {
+	// updates are serialized, so that a rejected batch rolls back to the right config
+	rs.updateMux.Lock()
+	defer rs.updateMux.Unlock()
+	rs.RLock()
 	//Populate the events based on the changed value between current config and newly received Config
-	rs.Lock()
-	defer rs.Unlock()
-	events, err = event.PopulateEvents(ConfigCenterSourceName, rs.currentConfig, config)
+	events, err := event.PopulateEvents(ConfigCenterSourceName, rs.currentConfig, config)
+	oldConfig := rs.currentConfig
+	rs.RUnlock()
 	if err != nil {
 		openlog.Warn(fmt.Sprintf("error in generating event %s", err))
 		return err
 	}
-	rs.currentConfig = config
-	//Generate OnEvent Callback based on the events created
-	if rs.eh != nil {
-		openlog.Debug(fmt.Sprintf("event on receive %v", events))
-		for _, e := range events {
-			rs.eh.OnEvent(e)
-		}
+	commit := func() {
+		rs.Lock()
+		rs.currentConfig = config
+		rs.Unlock()
+	}
+	rollback := func() {
+		rs.Lock()
+		rs.currentConfig = oldConfig
+		rs.Unlock()
+	}
+	if handler == nil || len(events) == 0 {
+		commit()
+		return nil
+	}
+	//Generate module event callback based on the events created
+	openlog.Debug(fmt.Sprintf("event on receive %v", events))
+	// handler reads configurations back, so it is called without lock
+	if err := source.CommitModuleEvent(handler, events, commit, rollback); err != nil {
+		openlog.Error("configs from config center rejected: " + err.Error())
+		return err
 	}
-
 	return nil
 }
 
@@ -186,24 +224,13 @@ func (rs *Source) Watch(callback source.EventHandler) error {
 	rs.eh = callback
 	if rs.RefreshMode == remote.ModeWatch {
 		// Pull All the configuration for the first time.
-		rs.refreshConfigurations()
+		rs.refreshConfigurations(callback)
 		//Start watch and receive change events.
 		err := rs.c.Watch(
 			func(kv map[string]interface{}) {
-				rs.RLock()
-				defer rs.RUnlock()
-				events, err := event.PopulateEvents(ConfigCenterSourceName, rs.currentConfig, kv)
-				if err != nil {
-					openlog.Error("error in generating event:" + err.Error())
-					return
+				if err := rs.updateConfigAndFireEvent(kv); err != nil {
+					openlog.Error("error in updating configurations:" + err.Error())
 				}
-
-				openlog.Debug(fmt.Sprintf("event on receive %v", events))
-				for _, e := range events {
-					callback.OnEvent(e)
-				}
-
-				return
 			},
 			func(err error) {
 				openlog.Error(err.Error())
@@ -223,6 +250,7 @@ func (rs *Source) Cleanup() error {
 	defer rs.connsLock.Unlock()
 
 	rs.currentConfig = nil
+	rs.pulled = false
 
 	return nil
 }
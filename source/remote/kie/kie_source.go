@@ -44,12 +44,16 @@ type Source struct {
 
 	sync.RWMutex
 	currentConfig map[string]interface{}
+	updateMux     sync.Mutex
 
 	RefreshMode     int
 	RefreshInterval time.Duration
 	priority        int
 
 	eh source.EventHandler
+	// pulled tells configs are pulled by GetConfigurations, periodic starts refreshing once
+	pulled   bool
+	periodic sync.Once
 }
 
 //NewKieSource initializes all components of ServiceComb-Kie
@@ -87,16 +91,26 @@ func NewKieSource(ci *archaius.RemoteInfo) (source.ConfigSource, error) {
 	return ks, nil
 }
 
-//GetConfigurations pull config from remote and start refresh configs interval
+//GetConfigurations pull config from remote and start refresh configs interval at the first time,
+//later it returns the configs pulled last, Reload pulls them again.
 // write a new map and return, internal map can not be operated outside struct
 func (ks *Source) GetConfigurations() (map[string]interface{}, error) {
 	configMap := make(map[string]interface{})
-	err := ks.refreshConfigurations()
-	if err != nil {
-		return nil, err
+	ks.RLock()
+	pulled := ks.pulled
+	ks.RUnlock()
+	if !pulled {
+		if err := ks.refreshConfigurations(ks.eh); err != nil {
+			return nil, err
+		}
+		ks.Lock()
+		ks.pulled = true
+		ks.Unlock()
 	}
 	if ks.RefreshMode == remote.ModeInterval {
-		go ks.refreshConfigurationsPeriodically()
+		ks.periodic.Do(func() {
+			go ks.refreshConfigurationsPeriodically()
+		})
 	}
 
 	ks.RLock()
@@ -112,7 +126,7 @@ func (ks *Source) refreshConfigurationsPeriodically() {
 	ticker := time.Tick(ks.RefreshInterval)
 	openlog.Info("start refreshing configurations")
 	for range ticker {
-		err := ks.refreshConfigurations()
+		err := ks.refreshConfigurations(ks.eh)
 		if err != nil {
 			openlog.Error("can not pull configs: " + err.Error())
 		}
@@ -120,7 +134,12 @@ func (ks *Source) refreshConfigurationsPeriodically() {
 	openlog.Info("stop refreshing configurations")
 }
 
-func (ks *Source) refreshConfigurations() error {
+//Reload pulls configs from remote immediately, and applies the changes to handler
+func (ks *Source) Reload(handler source.EventHandler) error {
+	return ks.refreshConfigurations(handler)
+}
+
+func (ks *Source) refreshConfigurations(handler source.EventHandler) error {
 	config, err := ks.k.PullConfigs(ks.dimensions...)
 	if err != nil {
 		openlog.Warn(fmt.Sprintf("failed to pull configurations from kie server %s", err)) //Warn
@@ -129,25 +148,47 @@ func (ks *Source) refreshConfigurations() error {
 	openlog.Debug("pull configs from kie", openlog.WithTags(openlog.Tags{
 		"config": config,
 	}))
-	return ks.updateConfigAndFireEvent(config)
+	return ks.updateConfig(handler, config)
 }
 
 func (ks *Source) updateConfigAndFireEvent(config map[string]interface{}) error {
-	ks.Lock()
-	defer ks.Unlock()
+	return ks.updateConfig(ks.eh, config)
+}
+
+// updateConfig applies the changes of config to handler, config replaces current config only if they are accepted
+func (ks *Source) updateConfig(handler source.EventHandler, config map[string]interface{}) error {
+	// updates are serialized, so that a rejected batch rolls back to the right config
+	ks.updateMux.Lock()
+	defer ks.updateMux.Unlock()
+	ks.RLock()
 	//Populate the events based on the changed value between current config and newly received Config
 	events, err := event.PopulateEvents(Name, ks.currentConfig, config)
+	oldConfig := ks.currentConfig
+	ks.RUnlock()
 	if err != nil {
 		openlog.Warn(fmt.Sprintf("generating event error %s", err))
 		return err
 	}
-	ks.currentConfig = config
-	//Generate OnEvent Callback based on the events created
-	if ks.eh != nil {
-		openlog.Debug(fmt.Sprintf("received event %v", events))
-		for _, e := range events {
-			ks.eh.OnEvent(e)
-		}
+	commit := func() {
+		ks.Lock()
+		ks.currentConfig = config
+		ks.Unlock()
+	}
+	rollback := func() {
+		ks.Lock()
+		ks.currentConfig = oldConfig
+		ks.Unlock()
+	}
+	if handler == nil || len(events) == 0 {
+		commit()
+		return nil
+	}
+	//Generate module event callback based on the events created
+	openlog.Debug(fmt.Sprintf("received event %v", events))
+	// handler reads configurations back, so it is called without lock
+	if err := source.CommitModuleEvent(handler, events, commit, rollback); err != nil {
+		openlog.Error("configs from kie rejected: " + err.Error())
+		return err
 	}
 	return nil
 }
@@ -224,6 +265,7 @@ func (ks *Source) Cleanup() error {
 	defer ks.Unlock()
 
 	ks.currentConfig = nil
+	ks.pulled = false
 
 	return nil
 }
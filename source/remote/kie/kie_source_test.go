@@ -1,9 +1,11 @@
 package kie
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/go-chassis/go-archaius"
+	"github.com/go-chassis/go-archaius/event"
 	"github.com/go-chassis/go-archaius/source/remote"
 	"github.com/stretchr/testify/assert"
 )
@@ -20,3 +22,38 @@ func TestNewKieSource(t *testing.T) {
 	_, err := NewKieSource(opts)
 	assert.NoError(t, err)
 }
+
+type rejectHandler struct {
+	batches [][]*event.Event
+}
+
+func (h *rejectHandler) OnEvent(e *event.Event) {}
+
+func (h *rejectHandler) OnModuleEvent(events []*event.Event) {}
+
+func (h *rejectHandler) ApplyModuleEvent(events []*event.Event) error {
+	for _, e := range events {
+		if e.Value == -1 {
+			return errors.New("negative value")
+		}
+	}
+	h.batches = append(h.batches, events)
+	return nil
+}
+
+func TestSource_updateConfigAndFireEvent(t *testing.T) {
+	h := &rejectHandler{}
+	ks := &Source{eh: h}
+	err := ks.updateConfigAndFireEvent(map[string]interface{}{"pool.size": 1, "pool.ttl": 2})
+	assert.NoError(t, err)
+	if assert.Len(t, h.batches, 1) {
+		assert.Len(t, h.batches[0], 2)
+	}
+
+	err = ks.updateConfigAndFireEvent(map[string]interface{}{"pool.size": -1, "pool.ttl": 3})
+	assert.Error(t, err)
+	assert.Len(t, h.batches, 1)
+	v, err := ks.GetConfigurationByKey("pool.ttl")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+}
@@ -0,0 +1,395 @@
+//Package secret loads mounted secrets, like kubernetes secrets and docker secrets,
+//each file of a directory is a key, and its content is the value
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-chassis/go-archaius/event"
+	"github.com/go-chassis/go-archaius/source"
+	"github.com/go-chassis/go-archaius/source/util"
+	"github.com/go-chassis/openlog"
+)
+
+const (
+	//SecretSourceConst is the name of secret source
+	SecretSourceConst    = "SecretSource"
+	secretSourcePriority = 3
+	// debounceWindow is the time directories must be quiet after a change before they are reloaded,
+	// a swap of "..data" symlink of kubernetes causes several events
+	debounceWindow = 50 * time.Millisecond
+)
+
+//Options is options of adding a directory
+type Options struct {
+	// Prefix is put before file name to make the key, like "secret." for key "secret.db.password"
+	Prefix string
+	// KeepNewline keeps trailing newlines of values, they are trimmed by default
+	KeepNewline bool
+	// NoRedaction writes values by WriteTo, they are redacted by default
+	NoRedaction bool
+}
+
+//Option is a func
+type Option func(options *Options)
+
+//WithPrefix puts prefix before file names to make keys
+func WithPrefix(prefix string) Option {
+	return func(options *Options) {
+		options.Prefix = prefix
+	}
+}
+
+//WithKeepNewline keeps trailing newlines of values
+func WithKeepNewline() Option {
+	return func(options *Options) {
+		options.KeepNewline = true
+	}
+}
+
+//WithoutRedaction writes values by WriteTo instead of redacting them
+func WithoutRedaction() Option {
+	return func(options *Options) {
+		options.NoRedaction = true
+	}
+}
+
+type dir struct {
+	path string
+	opts Options
+}
+
+type secret struct {
+	filePath string
+	value    interface{}
+	redact   bool
+}
+
+//Source is secret source
+type Source struct {
+	secrets   map[string]*secret
+	dirs      []dir
+	watcher   *fsnotify.Watcher
+	callback  source.EventHandler
+	debouncer *util.Debouncer
+	priority  int
+	// reloadMux makes reloads one by one
+	reloadMux sync.Mutex
+	sync.RWMutex
+}
+
+//SecretSource is a interface
+type SecretSource interface {
+	source.ConfigSource
+	AddDir(dir string, opts ...Option) error
+}
+
+//NewSecretSource creates a source which loads mounted secrets
+func NewSecretSource() SecretSource {
+	s := new(Source)
+	s.priority = secretSourcePriority
+	s.secrets = make(map[string]*secret)
+	return s
+}
+
+//AddDir adds a directory of secrets, each file is a key value, hidden files like "..data" are skipped.
+//if key conflicts, the directory added later wins
+func (s *Source) AddDir(p string, opts ...Option) error {
+	o := Options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	path, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("[%s] is not a directory", path)
+	}
+	s.Lock()
+	s.dirs = append(s.dirs, dir{path: path, opts: o})
+	watcher, callback := s.watcher, s.callback
+	s.Unlock()
+	if watcher != nil {
+		if err := watcher.Add(path); err != nil {
+			openlog.Error(fmt.Sprintf("add watcher file: %s fail: %s", path, err))
+		}
+	}
+	return s.reload(callback)
+}
+
+// read returns the secrets of directory by key
+func (d dir) read() (map[string]*secret, error) {
+	secrets := make(map[string]*secret)
+	infos, err := ioutil.ReadDir(d.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// secrets are unmounted
+			return secrets, nil
+		}
+		return nil, err
+	}
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		filePath := filepath.Join(d.path, info.Name())
+		// files are symlinks to "..data" in kubernetes
+		target, err := os.Stat(filePath)
+		if err != nil || !target.Mode().IsRegular() {
+			continue
+		}
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		secrets[d.opts.Prefix+info.Name()] = &secret{filePath: filePath,
+			value: d.value(content), redact: !d.opts.NoRedaction}
+	}
+	return secrets, nil
+}
+
+// value returns text as string without trailing newlines, and binary content as []byte
+func (d dir) value(content []byte) interface{} {
+	if !utf8.Valid(content) {
+		return content
+	}
+	if d.opts.KeepNewline {
+		return string(content)
+	}
+	return strings.TrimRight(string(content), "\r\n")
+}
+
+// reload reads all directories again and fires events of changes, the changes are published only if accepted
+func (s *Source) reload(callback source.EventHandler) error {
+	s.reloadMux.Lock()
+	defer s.reloadMux.Unlock()
+	s.RLock()
+	dirs := make([]dir, len(s.dirs))
+	copy(dirs, s.dirs)
+	s.RUnlock()
+
+	secrets := make(map[string]*secret)
+	for _, d := range dirs {
+		dirSecrets, err := d.read()
+		if err != nil {
+			return fmt.Errorf("read secrets of [%s] failed: %s", d.path, err)
+		}
+		for key, value := range dirSecrets {
+			secrets[key] = value
+		}
+	}
+
+	s.RLock()
+	old := s.secrets
+	events := diff(old, secrets)
+	s.RUnlock()
+	commit := func() {
+		s.Lock()
+		s.secrets = secrets
+		s.Unlock()
+	}
+	if callback == nil || len(events) == 0 {
+		commit()
+		return nil
+	}
+	rollback := func() {
+		s.Lock()
+		s.secrets = old
+		s.Unlock()
+	}
+	if err := source.CommitModuleEvent(callback, events, commit, rollback); err != nil {
+		return fmt.Errorf("changes of secrets rejected: %s", err)
+	}
+	return nil
+}
+
+// diff returns the events which change old secrets into new ones, sorted by key
+func diff(old, new map[string]*secret) []*event.Event {
+	events := make([]*event.Event, 0)
+	for key, o := range old {
+		n, ok := new[key]
+		if !ok {
+			events = append(events, &event.Event{EventSource: SecretSourceConst, Key: key,
+				EventType: event.Delete, Value: o.value})
+			continue
+		}
+		if !reflect.DeepEqual(o.value, n.value) {
+			events = append(events, &event.Event{EventSource: SecretSourceConst, Key: key,
+				EventType: event.Update, Value: n.value})
+		}
+	}
+	for key, n := range new {
+		if _, ok := old[key]; ok {
+			continue
+		}
+		events = append(events, &event.Event{EventSource: SecretSourceConst, Key: key,
+			EventType: event.Create, Value: n.value})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
+
+//GetConfigurations get all secrets
+func (s *Source) GetConfigurations() (map[string]interface{}, error) {
+	s.RLock()
+	defer s.RUnlock()
+	configMap := make(map[string]interface{}, len(s.secrets))
+	for key, value := range s.secrets {
+		configMap[key] = value.value
+	}
+	return configMap, nil
+}
+
+//GetConfigurationByKey get one secret by key
+func (s *Source) GetConfigurationByKey(key string) (interface{}, error) {
+	s.RLock()
+	defer s.RUnlock()
+	value, ok := s.secrets[key]
+	if !ok {
+		return nil, source.ErrKeyNotExist
+	}
+	return value.value, nil
+}
+
+//KeyLocation returns the file of secret
+func (s *Source) KeyLocation(key string) (string, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	value, ok := s.secrets[key]
+	if !ok {
+		return "", false
+	}
+	return value.filePath, true
+}
+
+//Redact reports whether secret should be hidden when configurations are written out
+func (s *Source) Redact(key string) bool {
+	s.RLock()
+	defer s.RUnlock()
+	value, ok := s.secrets[key]
+	return ok && value.redact
+}
+
+//GetSourceName returns name of source
+func (*Source) GetSourceName() string {
+	return SecretSourceConst
+}
+
+//GetPriority returns priority of source
+func (s *Source) GetPriority() int {
+	return s.priority
+}
+
+//SetPriority custom priority
+func (s *Source) SetPriority(priority int) {
+	s.priority = priority
+}
+
+//Reload reads all directories again and applies the changes to handler
+func (s *Source) Reload(handler source.EventHandler) error {
+	return s.reload(handler)
+}
+
+//Watch watches directories, a change of them reloads all secrets,
+//directories are watched instead of files, so that a swap of "..data" symlink is noticed
+func (s *Source) Watch(callback source.EventHandler) error {
+	if callback == nil {
+		return errors.New("call back can not be nil")
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		openlog.Error("New file watcher failed:" + err.Error())
+		return err
+	}
+	s.Lock()
+	s.watcher = watcher
+	s.callback = callback
+	s.debouncer = util.NewDebouncer()
+	debouncer := s.debouncer
+	dirs := make([]dir, len(s.dirs))
+	copy(dirs, s.dirs)
+	s.Unlock()
+	for _, d := range dirs {
+		if err := watcher.Add(d.path); err != nil {
+			openlog.Error(fmt.Sprintf("add watcher file: %s fail: %s", d.path, err))
+		}
+	}
+	go s.watch(watcher, debouncer, callback)
+	// changes made before watching are not missed
+	return s.reload(callback)
+}
+
+func (s *Source) watch(watcher *fsnotify.Watcher, debouncer *util.Debouncer, callback source.EventHandler) {
+	for {
+		select {
+		case e, ok := <-watcher.Events:
+			if !ok {
+				openlog.Warn("secret watcher stop")
+				return
+			}
+			openlog.Debug(fmt.Sprintf("secret event %s, operation is %d", e.Name, e.Op))
+			debouncer.Debounce(SecretSourceConst, debounceWindow, func() {
+				if err := s.reload(callback); err != nil {
+					openlog.Error(err.Error())
+				}
+			})
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				openlog.Warn("secret watcher stop")
+				return
+			}
+			openlog.Error(fmt.Sprintf("watch secret error: %s", err))
+		}
+	}
+}
+
+//Cleanup clear all secrets
+func (s *Source) Cleanup() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.watcher != nil {
+		s.watcher.Close()
+		s.watcher = nil
+	}
+	if s.debouncer != nil {
+		s.debouncer.Stop()
+		s.debouncer = nil
+	}
+	s.callback = nil
+	s.dirs = nil
+	s.secrets = make(map[string]*secret)
+	return nil
+}
+
+//AddDimensionInfo no use
+func (s *Source) AddDimensionInfo(labels map[string]string) error {
+	return nil
+}
+
+//Set no use
+func (s *Source) Set(key string, value interface{}) error {
+	return nil
+}
+
+//Delete no use
+func (s *Source) Delete(key string) error {
+	return nil
+}
@@ -0,0 +1,111 @@
+package secret_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chassis/go-archaius/event"
+	"github.com/go-chassis/go-archaius/source"
+	"github.com/go-chassis/go-archaius/source/secret"
+	"github.com/stretchr/testify/assert"
+)
+
+type lockedHandler struct {
+	mu     sync.Mutex
+	events []*event.Event
+}
+
+func (h *lockedHandler) OnEvent(e *event.Event) {}
+
+func (h *lockedHandler) OnModuleEvent(events []*event.Event) {
+	h.mu.Lock()
+	h.events = append(h.events, events...)
+	h.mu.Unlock()
+}
+
+func (h *lockedHandler) count(eventType string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, e := range h.events {
+		if e.EventType == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSecretSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "db.password"), []byte("s3cret\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tls.key"), []byte{0xff, 0xfe, 0x00}, 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0600))
+
+	s := secret.NewSecretSource()
+	assert.NoError(t, s.AddDir(dir, secret.WithPrefix("secret.")))
+	defer s.Cleanup()
+	configs, err := s.GetConfigurations()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"secret.db.password": "s3cret",
+		"secret.tls.key":     []byte{0xff, 0xfe, 0x00},
+	}, configs)
+	assert.True(t, s.(source.Redactor).Redact("secret.db.password"))
+	location, _ := s.(source.KeyLocator).KeyLocation("secret.db.password")
+	assert.Equal(t, filepath.Join(dir, "db.password"), location)
+
+	t.Run("keep newline and no redaction", func(t *testing.T) {
+		s := secret.NewSecretSource()
+		assert.NoError(t, s.AddDir(dir, secret.WithKeepNewline(), secret.WithoutRedaction()))
+		defer s.Cleanup()
+		v, err := s.GetConfigurationByKey("db.password")
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cret\n", v)
+		assert.False(t, s.(source.Redactor).Redact("db.password"))
+	})
+	t.Run("not a directory", func(t *testing.T) {
+		assert.Error(t, secret.NewSecretSource().AddDir(filepath.Join(dir, "db.password")))
+	})
+}
+
+// TestWatchDataSwap updates secrets the way kubernetes does,
+// files are symlinks to "..data", which is swapped to a new timestamped directory atomically
+func TestWatchDataSwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeVersion := func(version string, secrets map[string]string) {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, version), 0700))
+		for name, value := range secrets {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, version, name), []byte(value), 0600))
+		}
+		assert.NoError(t, os.Symlink(version, filepath.Join(dir, "..data_tmp")))
+		assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	}
+	writeVersion("..v1", map[string]string{"user": "admin\n", "password": "old\n"})
+	for _, name := range []string{"user", "password"} {
+		assert.NoError(t, os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name)))
+	}
+
+	s := secret.NewSecretSource()
+	assert.NoError(t, s.AddDir(dir))
+	h := &lockedHandler{}
+	assert.NoError(t, s.Watch(h))
+	defer s.Cleanup()
+	valueOf := func(key string) interface{} {
+		v, _ := s.GetConfigurationByKey(key)
+		return v
+	}
+	assert.Equal(t, "old", valueOf("password"))
+
+	writeVersion("..v2", map[string]string{"user": "admin\n", "password": "new\n"})
+	assert.Eventually(t, func() bool { return valueOf("password") == "new" }, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, h.count(event.Update))
+	assert.Equal(t, "admin", valueOf("user"))
+}
@@ -22,3 +22,114 @@ type EventHandler interface {
 	OnEvent(event *event.Event)
 	OnModuleEvent(events []*event.Event)
 }
+
+// TransactionalEventHandler is an EventHandler which applies a batch of events as a whole.
+// ApplyModuleEvent returns an error if the batch is rejected, sources should then roll back their local state
+type TransactionalEventHandler interface {
+	EventHandler
+	ApplyModuleEvent(events []*event.Event) error
+}
+
+// ApplyModuleEvent delivers events to handler as one batch.
+// it returns the rejection error if handler is a TransactionalEventHandler,
+// other handlers receive each event by OnEvent and then the whole batch by OnModuleEvent
+func ApplyModuleEvent(handler EventHandler, events []*event.Event) error {
+	if th, ok := handler.(TransactionalEventHandler); ok {
+		return th.ApplyModuleEvent(events)
+	}
+	for _, e := range events {
+		handler.OnEvent(e)
+	}
+	handler.OnModuleEvent(events)
+	return nil
+}
+
+// CommittingEventHandler is a TransactionalEventHandler which validates a batch before the source publishes it,
+// CommitModuleEvent calls commit only if events are accepted, and applies them after commit
+type CommittingEventHandler interface {
+	TransactionalEventHandler
+	CommitModuleEvent(events []*event.Event, commit func()) error
+}
+
+// CommitModuleEvent delivers events to handler as one batch, commit publishes the new state of source.
+// if handler is a CommittingEventHandler, commit is called only when the batch is accepted,
+// so that rejected values are never visible. other handlers get events after commit,
+// and rollback restores the old state if a TransactionalEventHandler rejects them
+func CommitModuleEvent(handler EventHandler, events []*event.Event, commit, rollback func()) error {
+	if ch, ok := handler.(CommittingEventHandler); ok {
+		return ch.CommitModuleEvent(events, commit)
+	}
+	commit()
+	if err := ApplyModuleEvent(handler, events); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+// RemovalEventHandler is an EventHandler which applies events caused by removing a part of a source,
+// like a file, without validation, because the source can't keep the removed configs
+type RemovalEventHandler interface {
+	EventHandler
+	ApplyRemovalEvent(events []*event.Event) error
+}
+
+// ApplyRemovalEvent delivers events caused by removing a part of a source to handler,
+// handlers which are not RemovalEventHandler get them by OnModuleEvent
+func ApplyRemovalEvent(handler EventHandler, events []*event.Event) error {
+	if rh, ok := handler.(RemovalEventHandler); ok {
+		return rh.ApplyRemovalEvent(events)
+	}
+	handler.OnModuleEvent(events)
+	return nil
+}
+
+// Flusher is an optional interface of ConfigSource,
+// Flush applies changes the source has not noticed yet to handler, like a file written but not reported by watcher.
+// it does not depend on Watch, because Watch may run asynchronously
+type Flusher interface {
+	Flush(handler EventHandler) error
+}
+
+// Reloader is an optional interface of ConfigSource,
+// Reload reads the source again and applies the changes to handler, like a file fixed by operators,
+// environment variables changed by reloading an environment file, or a pull of remote config forced.
+// it works for sources which are not watched too
+type Reloader interface {
+	Reload(handler EventHandler) error
+}
+
+// ErrorHandler is an optional interface of EventHandler,
+// sources report errors of their parts to it, like a file with syntax error
+type ErrorHandler interface {
+	OnSourceError(e *event.SourceError)
+}
+
+// ReportError sends e to handler if it is an ErrorHandler
+func ReportError(handler EventHandler, e *event.SourceError) {
+	if eh, ok := handler.(ErrorHandler); ok {
+		eh.OnSourceError(e)
+	}
+}
+
+// ErrorReporter is an optional interface of ConfigSource,
+// Errors returns the current errors of the parts which fail to load, sorted by location
+type ErrorReporter interface {
+	Errors() []*event.SourceError
+}
+
+// KeyLocator is an optional interface of ConfigSource,
+// KeyLocation tells where the value of key comes from in the source, like the path of a file
+type KeyLocator interface {
+	KeyLocation(key string) (string, bool)
+}
+
+// RedactedValue replaces the values of sensitive keys when configurations are written out
+const RedactedValue = "******"
+
+// Redactor is an optional interface of ConfigSource,
+// Redact reports whether the value of key is sensitive, like a password, it is redacted by Marshal.
+// values of events from a Redactor are never logged
+type Redactor interface {
+	Redact(key string) bool
+}
@@ -0,0 +1,74 @@
+package source
+
+import (
+	"time"
+
+	"github.com/go-chassis/go-archaius/event"
+	"github.com/go-chassis/openlog"
+)
+
+// Status records the latest state of a config source
+type Status struct {
+	Name string
+	// RejectedCount is the number of event batches rejected by validators
+	RejectedCount int
+	// LastRejection is the latest batch rejected by validators
+	LastRejection *Rejection
+	// Errors are the parts of source which fail to load, like files with syntax error,
+	// their last good configurations are still used
+	Errors []*event.SourceError
+}
+
+// Rejection describes a batch of events which was not applied
+type Rejection struct {
+	Time   time.Time
+	Err    error
+	Events []*event.Event
+}
+
+func (m *Manager) recordRejection(events []*event.Event, err error) {
+	names := make(map[string]bool)
+	for _, e := range events {
+		names[e.EventSource] = true
+	}
+	m.statusMux.Lock()
+	defer m.statusMux.Unlock()
+	r := &Rejection{Time: time.Now(), Err: err, Events: events}
+	for name := range names {
+		s, ok := m.status[name]
+		if !ok {
+			s = &Status{Name: name}
+			m.status[name] = s
+		}
+		s.RejectedCount++
+		s.LastRejection = r
+	}
+}
+
+// SourceStatus returns the status of a source
+func (m *Manager) SourceStatus(sourceName string) (Status, bool) {
+	m.sourceMapMux.RLock()
+	src, ok := m.Sources[sourceName]
+	m.sourceMapMux.RUnlock()
+	if !ok {
+		return Status{}, false
+	}
+	m.statusMux.RLock()
+	status := Status{Name: sourceName}
+	if s, ok := m.status[sourceName]; ok {
+		status = *s
+	}
+	m.statusMux.RUnlock()
+	if r, ok := src.(ErrorReporter); ok {
+		status.Errors = r.Errors()
+	}
+	return status, true
+}
+
+// OnSourceError dispatches an error of source to error listeners
+func (m *Manager) OnSourceError(e *event.SourceError) {
+	defer m.drain()
+	if err := m.dispatcher.DispatchErrorEvent(e); err != nil {
+		openlog.Error("failed to dispatch source error: " + err.Error())
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -478,6 +479,12 @@ func checkPrefix(heap, prefix string) (bool, int) {
 
 // set values in object
 func (m *Manager) setValue(rValue reflect.Value, keyName string) error {
+	if rValue.Kind() == reflect.Slice {
+		// items given by indexed keys like "servers[1].port" may be overridden by other sources
+		if l := m.indexedLen(keyName); l > 0 {
+			return m.setIndexedSlice(rValue, keyName, l)
+		}
+	}
 	configValue := m.GetConfig(keyName)
 	if configValue == nil {
 		return nil
@@ -499,6 +506,42 @@ func (m *Manager) setValue(rValue reflect.Value, keyName string) error {
 	return nil
 }
 
+// indexedLen returns the length of the sequence given by indexed keys of keyName, 0 if there is none
+func (m *Manager) indexedLen(keyName string) int {
+	prefix := keyName + "["
+	l := 0
+	m.ConfigurationMap.Range(func(key, value interface{}) bool {
+		k := key.(string)
+		if !strings.HasPrefix(k, prefix) {
+			return true
+		}
+		end := strings.Index(k[len(prefix):], "]")
+		if end < 0 {
+			return true
+		}
+		if i, err := strconv.Atoi(k[len(prefix) : len(prefix)+end]); err == nil && i >= l {
+			l = i + 1
+		}
+		return true
+	})
+	return l
+}
+
+// setIndexedSlice sets each item of slice from its indexed keys, like a struct from "servers[0].host"
+func (m *Manager) setIndexedSlice(rValue reflect.Value, keyName string, l int) error {
+	slice := reflect.MakeSlice(rValue.Type(), l, l)
+	for i := 0; i < l; i++ {
+		err := m.unmarshal(slice.Index(i), fmt.Sprintf("%s[%d]", keyName, i))
+		if err != nil {
+			return err
+		}
+	}
+	if rValue.CanSet() {
+		rValue.Set(slice)
+	}
+	return nil
+}
+
 // get key from tag
 func (*Manager) getKeyName(fieldName string, fieldTagName reflect.StructTag) string {
 	tagName := fieldTagName.Get(configClientTag)
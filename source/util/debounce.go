@@ -0,0 +1,50 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// Debouncer runs the latest func of a key once the key is quiet for a window,
+// so that a burst of file events, like Write, Write, Chmod of one save, causes one reload
+type Debouncer struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// NewDebouncer creates a Debouncer
+func NewDebouncer() *Debouncer {
+	return &Debouncer{timers: make(map[string]*time.Timer)}
+}
+
+// Debounce runs fn after window, if key is debounced again before that, fn is replaced and window restarts
+func (d *Debouncer) Debounce(key string, window time.Duration, fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t, ok := d.timers[key]; ok {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(window, func() {
+		d.mu.Lock()
+		if d.timers[key] != t {
+			// replaced by a later call
+			d.mu.Unlock()
+			return
+		}
+		delete(d.timers, key)
+		d.mu.Unlock()
+		fn()
+	})
+	d.timers[key] = t
+}
+
+// Stop cancels all funcs not run yet
+func (d *Debouncer) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, t := range d.timers {
+		t.Stop()
+		delete(d.timers, key)
+	}
+}
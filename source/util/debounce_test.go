@@ -0,0 +1,32 @@
+package util
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebouncer(t *testing.T) {
+	d := NewDebouncer()
+	var runs, last int32
+	for i := int32(1); i <= 5; i++ {
+		v := i
+		d.Debounce("a.yaml", 50*time.Millisecond, func() {
+			atomic.AddInt32(&runs, 1)
+			atomic.StoreInt32(&last, v)
+		})
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+	assert.Equal(t, int32(5), atomic.LoadInt32(&last))
+
+	d.Debounce("a.yaml", 50*time.Millisecond, func() {
+		atomic.AddInt32(&runs, 1)
+	})
+	d.Stop()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+}
@@ -0,0 +1,132 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const escapedDollar = '\x00'
+
+// Convert2DotEnvProps is a FileHandler
+// it converts .env content into key values, keys are mapped like env source does by default, A_B becomes A.B.
+// it supports "export" prefix, "#" comments, single and double quotes,
+// and placeholders like ExpandEnv does, which refer to keys defined before or environment variables.
+// single quoted values are kept as they are
+func Convert2DotEnvProps(p string, content []byte) (map[string]interface{}, error) {
+	vars := make(map[string]string)
+	configMap := make(map[string]interface{})
+	s := strings.ReplaceAll(strings.TrimPrefix(string(content), "\ufeff"), "\r\n", "\n")
+	line := 1
+	for len(s) > 0 {
+		var raw string
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			raw, s = s[:i], s[i+1:]
+		} else {
+			raw, s = s, ""
+		}
+		lineNum := line
+		line++
+		raw = strings.TrimSpace(raw)
+		if raw == "" || raw[0] == '#' {
+			continue
+		}
+		raw = strings.TrimSpace(strings.TrimPrefix(raw, "export "))
+		eq := strings.IndexByte(raw, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("dotenv [%s] line %d: expect KEY=VALUE", p, lineNum)
+		}
+		key := strings.TrimSpace(raw[:eq])
+		value := strings.TrimLeft(raw[eq+1:], " \t")
+
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.IndexByte(value[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("dotenv [%s] line %d: unclosed single quote", p, lineNum)
+			}
+			value = value[1 : end+1]
+		case strings.HasPrefix(value, `"`):
+			// double quoted value can span lines
+			v, rest, n, err := readDoubleQuoted(value[1:], s)
+			if err != nil {
+				return nil, fmt.Errorf("dotenv [%s] line %d: %s", p, lineNum, err)
+			}
+			s = rest
+			line += n
+			expanded, err := expandDotEnv(v, vars)
+			if err != nil {
+				return nil, fmt.Errorf("dotenv [%s] line %d: %s", p, lineNum, err)
+			}
+			value = strings.ReplaceAll(expanded, string(escapedDollar), "$")
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = value[:i]
+			}
+			expanded, err := expandDotEnv(strings.TrimSpace(value), vars)
+			if err != nil {
+				return nil, fmt.Errorf("dotenv [%s] line %d: %s", p, lineNum, err)
+			}
+			value = expanded
+		}
+
+		vars[key] = value
+		configMap[strings.Replace(key, "_", ".", -1)] = value
+	}
+	return configMap, nil
+}
+
+// readDoubleQuoted reads a double quoted value starting at first, it continues to read rest if the quote is not closed.
+// it returns the unescaped value, the unread content and the number of lines consumed from rest
+func readDoubleQuoted(first, rest string) (string, string, int, error) {
+	var b strings.Builder
+	text := first
+	lines := 0
+	for {
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			switch {
+			case c == '"':
+				return b.String(), rest, lines, nil
+			case c == '\\' && i+1 < len(text):
+				i++
+				switch text[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case 'r':
+					b.WriteByte('\r')
+				case '$':
+					// escaped $ must not be expanded, it is restored after expanding
+					b.WriteByte(escapedDollar)
+				default:
+					// \" \\ and unknown escapes keep the escaped char
+					b.WriteByte(text[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		if rest == "" {
+			return "", "", lines, fmt.Errorf("unclosed double quote")
+		}
+		b.WriteByte('\n')
+		if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			text, rest = rest[:i], rest[i+1:]
+		} else {
+			text, rest = rest, ""
+		}
+		lines++
+	}
+}
+
+// expandDotEnv expands placeholders of value with keys defined before, or environment variables
+func expandDotEnv(value string, vars map[string]string) (string, error) {
+	return expandEnv(value, func(name string) string {
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return os.Getenv(name)
+	})
+}
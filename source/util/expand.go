@@ -1,20 +1,20 @@
 package util
 
 import (
+	"fmt"
 	"os"
-	"regexp"
 	"strings"
 )
 
-// The name of a variable can contain only letters (a to z or A to Z), numbers ( 0 to 9) or
-// the underscore character ( _), and can't begin with number.
-const envVariable = `\${([a-zA-Z_]{1}[\w]+)((?:\,\,|\^\^)?)[\|]{2}(.*?)}`
-
-// reg exp
-var variableReg *regexp.Regexp
-
-func init() {
-	variableReg = regexp.MustCompile(envVariable)
+// placeholder is a parsed ${NAME...} of a value
+type placeholder struct {
+	name string
+	// modifier is "^^" to upper case, or ",," to lower case the value of variable
+	modifier string
+	// op is "||" or ":-" for default, ":?" for required, or empty
+	op string
+	// arg is the default value or the error message, it may have nested placeholders
+	arg []interface{}
 }
 
 // if string like ${NAME||archaius}
@@ -24,30 +24,151 @@ func init() {
 //    value string => addr:${IP||127.0.0.1}:${PORT||8080}
 //    if environment variable =>  IP=0.0.0.0 PORT=443 , result => addr:0.0.0.0:443
 //    if no exist environment variable                , result => addr:127.0.0.1:8080
+// see ExpandEnv for all forms, if a required variable is not set, value is returned without expansion.
+// white space around value is trimmed
 func ExpandValueEnv(value string) (realValue string) {
-	value = strings.TrimSpace(value)
-	submatch := variableReg.FindAllStringSubmatch(value, -1)
-	if len(submatch) == 0 {
-		return value
+	realValue, err := ExpandEnv(strings.TrimSpace(value))
+	if err != nil {
+		return strings.TrimSpace(value)
 	}
+	return realValue
+}
+
+// ExpandEnv expands environment variable placeholders of value, it supports:
+//    ${NAME}                  value of NAME, or "" if it is not set
+//    ${NAME||default}         default if NAME is not set or empty, default may be nested, like ${A||${B||x}}
+//    ${NAME:-default}         same as ${NAME||default}
+//    ${NAME:?message}         error with message if NAME is not set or empty
+//    ${NAME^^} and ${NAME,,}  value of NAME in upper or lower case, like ${NAME^^||default}
+//    \${                      a literal "${"
+// a name has letters, digits and "_", and can't begin with digit. malformed placeholders are kept as they are,
+// and white space of value is kept, parsers trim the white space which is not escaped or quoted
+func ExpandEnv(value string) (string, error) {
+	return expandEnv(value, os.Getenv)
+}
+
+// expandEnv expands placeholders of value like ExpandEnv, variables are looked up by getenv
+func expandEnv(value string, getenv func(name string) string) (string, error) {
+	nodes, _, _ := parseEnv(value, 0, false)
+	return evaluateEnv(nodes, getenv)
+}
 
-	realValue = value
-	for _, sub := range submatch {
-		if len(sub) != 4 { //rule matching behaves in an unexpected way
-			continue
+// parseEnv splits s from i into literal strings and placeholders,
+// if nested, it stops after the "}" which closes the placeholder, and reports whether it is found
+func parseEnv(s string, i int, nested bool) ([]interface{}, int, bool) {
+	nodes := make([]interface{}, 0)
+	var literal strings.Builder
+	for i < len(s) {
+		switch {
+		case nested && s[i] == '}':
+			return appendLiteral(nodes, &literal), i + 1, true
+		case strings.HasPrefix(s[i:], `\${`):
+			literal.WriteString("${")
+			i += 3
+		case strings.HasPrefix(s[i:], "${"):
+			p, next, ok := parsePlaceholder(s, i)
+			if !ok {
+				literal.WriteByte(s[i])
+				i++
+				continue
+			}
+			nodes = append(appendLiteral(nodes, &literal), p)
+			i = next
+		default:
+			literal.WriteByte(s[i])
+			i++
 		}
-		item := os.Getenv(sub[1])
-		if item == "" {
-			item = sub[3]
-		} else {
-			if sub[2] == "^^" {
-				item = strings.ToUpper(item)
-			} else if sub[2] == ",," {
-				item = strings.ToLower(item)
+	}
+	return appendLiteral(nodes, &literal), i, false
+}
+
+func appendLiteral(nodes []interface{}, literal *strings.Builder) []interface{} {
+	if literal.Len() > 0 {
+		nodes = append(nodes, literal.String())
+		literal.Reset()
+	}
+	return nodes
+}
+
+// parsePlaceholder parses the placeholder starts at i, it returns false if the placeholder is malformed
+func parsePlaceholder(s string, i int) (*placeholder, int, bool) {
+	j := i + 2
+	start := j
+	for j < len(s) && (s[j] == '_' || isLetter(s[j]) || j > start && isDigit(s[j])) {
+		j++
+	}
+	if j == start {
+		return nil, i, false
+	}
+	p := &placeholder{name: s[start:j]}
+	if strings.HasPrefix(s[j:], "^^") || strings.HasPrefix(s[j:], ",,") {
+		p.modifier = s[j : j+2]
+		j += 2
+	}
+	switch {
+	case strings.HasPrefix(s[j:], "}"):
+		return p, j + 1, true
+	case strings.HasPrefix(s[j:], "||"), strings.HasPrefix(s[j:], ":-"), strings.HasPrefix(s[j:], ":?"):
+		p.op = s[j : j+2]
+		arg, next, closed := parseEnv(s, j+2, true)
+		if !closed {
+			return nil, i, false
+		}
+		p.arg = arg
+		return p, next, true
+	}
+	return nil, i, false
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// evaluateEnv joins literals and values of placeholders, a default is evaluated only if it is used
+func evaluateEnv(nodes []interface{}, getenv func(name string) string) (string, error) {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case string:
+			b.WriteString(n)
+		case *placeholder:
+			v, err := n.value(getenv)
+			if err != nil {
+				return "", err
 			}
+			b.WriteString(v)
 		}
-		realValue = strings.ReplaceAll(realValue, sub[0], item)
 	}
+	return b.String(), nil
+}
 
-	return
+func (p *placeholder) value(getenv func(name string) string) (string, error) {
+	v := getenv(p.name)
+	if v != "" {
+		switch p.modifier {
+		case "^^":
+			v = strings.ToUpper(v)
+		case ",,":
+			v = strings.ToLower(v)
+		}
+		return v, nil
+	}
+	switch p.op {
+	case "||", ":-":
+		return evaluateEnv(p.arg, getenv)
+	case ":?":
+		msg, err := evaluateEnv(p.arg, getenv)
+		if err != nil {
+			return "", err
+		}
+		if msg == "" {
+			msg = "environment variable is not set"
+		}
+		return "", fmt.Errorf("%s: %s", p.name, msg)
+	}
+	return "", nil
 }
@@ -59,3 +59,39 @@ func TestExpandValueEnv(t *testing.T) {
 	assert.Equal(t, "env:test", ExpandValueEnv(str12))
 	os.Unsetenv("UPPER_ENV")
 }
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("EXPAND_HOST", "Example.com")
+	defer os.Unsetenv("EXPAND_HOST")
+	os.Unsetenv("EXPAND_MISSING")
+
+	cases := map[string]string{
+		"${EXPAND_HOST}":                          "Example.com",
+		"${EXPAND_HOST,,}":                        "example.com",
+		"${EXPAND_MISSING}":                       "",
+		"${EXPAND_MISSING||${EXPAND_HOST||x}}":    "Example.com",
+		"${EXPAND_MISSING||${EXPAND_MISSING||x}}": "x",
+		"${EXPAND_MISSING:-x}":                    "x",
+		"${EXPAND_HOST||${EXPAND_MISSING:?set}}":  "Example.com",
+		`\${EXPAND_HOST}`:                         "${EXPAND_HOST}",
+		`${EXPAND_MISSING||\${x}}`:                "${x}",
+		"${EXPAND_HOST:?must be set}":             "Example.com",
+		"${EXPAND_HOST||unclosed":                 "${EXPAND_HOST||unclosed",
+	}
+	for value, expected := range cases {
+		v, err := ExpandEnv(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, v, value)
+	}
+
+	_, err := ExpandEnv("pass:${EXPAND_MISSING:?must be set}")
+	assert.EqualError(t, err, "EXPAND_MISSING: must be set")
+	_, err = ExpandEnv("${EXPAND_MISSING||${EXPAND_MISSING:?}}")
+	assert.EqualError(t, err, "EXPAND_MISSING: environment variable is not set")
+	assert.Equal(t, "${EXPAND_MISSING:?}", ExpandValueEnv("${EXPAND_MISSING:?}"))
+
+	_, err = Convert2JavaProps("app.yaml", []byte("db:\n  password: ${EXPAND_MISSING:?must be set}\n"))
+	assert.EqualError(t, err, "yaml [app.yaml]: key [db.password]: EXPAND_MISSING: must be set")
+	_, err = Convert2PropertiesProps("app.properties", []byte("a=1\nb=${EXPAND_MISSING:?}\n"))
+	assert.Error(t, err)
+}
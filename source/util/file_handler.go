@@ -1,8 +1,14 @@
 package util
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/go-chassis/openlog"
 	"gopkg.in/yaml.v2"
@@ -13,53 +19,94 @@ import (
 type FileHandler func(filePath string, content []byte) (map[string]interface{}, error)
 
 //Convert2JavaProps is a FileHandler
-//it convert the yaml content into java props
+//it convert the yaml content into java props.
+//a top level "archaius.imports" list merges other files, and "!include path" makes a value the content of another file,
+//paths are relative to the yaml file. documents of a multi-document file are merged in order,
+//anchors and merge keys like "<<: *base" are resolved
 func Convert2JavaProps(p string, content []byte) (map[string]interface{}, error) {
+	return convert2JavaProps(p, content, false)
+}
+
+//Convert2JavaPropsWithIndexedKeys is a FileHandler like Convert2JavaProps,
+//besides the list value of a sequence, it also gives a key to each item, like "servers[0].host",
+//so that an item can be overridden by other sources
+func Convert2JavaPropsWithIndexedKeys(p string, content []byte) (map[string]interface{}, error) {
+	return convert2JavaProps(p, content, true)
+}
+
+func convert2JavaProps(p string, content []byte, indexed bool) (map[string]interface{}, error) {
+	if hasImports(content) {
+		return convertWithImports(p, content, indexed)
+	}
+	ForgetImports(p)
+	return convertYAML(p, content, indexed)
+}
+
+func convertYAML(p string, content []byte, indexed bool) (map[string]interface{}, error) {
 	configMap := make(map[string]interface{})
 
-	ss := yaml.MapSlice{}
-	err := yaml.Unmarshal([]byte(content), &ss)
-	if err != nil {
-		return nil, fmt.Errorf("yaml unmarshal [%s] failed, %s", content, err)
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc interface{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("yaml unmarshal [%s] failed, %s", p, err)
+		}
+		if doc == nil {
+			continue
+		}
+		items, ok := doc.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("yaml unmarshal [%s] failed, content is not a map", p)
+		}
+		result := retrieveItems("", items, indexed)
+		if err := expandItems(result); err != nil {
+			return nil, fmt.Errorf("yaml [%s]: %s", p, err)
+		}
+		// a later document overrides an earlier one
+		mergeItems(configMap, result)
 	}
-	configMap = retrieveItems("", ss)
 
 	return configMap, nil
 }
-func retrieveItems(prefix string, subItems yaml.MapSlice) map[string]interface{} {
+func retrieveItems(prefix string, subItems map[interface{}]interface{}, indexed bool) map[string]interface{} {
 	if prefix != "" {
 		prefix += "."
 	}
 
 	result := map[string]interface{}{}
 
-	for _, item := range subItems {
+	for key, value := range subItems {
 		//check the item key first
-		k, ok := checkKey(item.Key)
+		k, ok := checkKey(key)
 		if !ok {
 			continue
 		}
 		//If there are sub-items existing
-		switch item.Value.(type) {
+		switch value.(type) {
 		//sub items in a map
-		case yaml.MapSlice:
-			subResult := retrieveItems(prefix+item.Key.(string), item.Value.(yaml.MapSlice))
+		case map[interface{}]interface{}:
+			subResult := retrieveItems(prefix+k, value.(map[interface{}]interface{}), indexed)
 			for k, v := range subResult {
 				result[k] = v
 			}
 
 		// sub items in an array
 		case []interface{}:
-			keyVal := item.Value.([]interface{})
+			keyVal := value.([]interface{})
+			if indexed {
+				for k, v := range retrieveIndexedItems(prefix+k, keyVal) {
+					result[k] = v
+				}
+			}
 			result[prefix+k] = retrieveItemInSlice(keyVal)
 
-		// sub item is a string
-		case string:
-			result[prefix+k] = ExpandValueEnv(item.Value.(string))
-
 		// sub item in other type
 		default:
-			result[prefix+k] = item.Value
+			result[prefix+k] = value
 
 		}
 
@@ -68,6 +115,44 @@ func retrieveItems(prefix string, subItems yaml.MapSlice) map[string]interface{}
 	return result
 }
 
+// retrieveIndexedItems gives a key to each item of a sequence, like "servers[0].host"
+func retrieveIndexedItems(key string, value []interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for i, v := range value {
+		itemKey := fmt.Sprintf("%s[%d]", key, i)
+		switch v := v.(type) {
+		case map[interface{}]interface{}:
+			for k, subValue := range retrieveItems(itemKey, v, true) {
+				result[k] = subValue
+			}
+		case []interface{}:
+			for k, subValue := range retrieveIndexedItems(itemKey, v) {
+				result[k] = subValue
+			}
+		default:
+			result[itemKey] = v
+		}
+	}
+	return result
+}
+
+// mergeItems copies src into dst, a sequence in src also replaces the indexed keys of the one in dst
+func mergeItems(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if _, ok := v.([]interface{}); !ok {
+			continue
+		}
+		for old := range dst {
+			if _, ok := src[old]; !ok && strings.HasPrefix(old, k+"[") {
+				delete(dst, old)
+			}
+		}
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
 func checkKey(key interface{}) (string, bool) {
 	k, ok := key.(string)
 	if !ok {
@@ -84,10 +169,8 @@ func checkKey(key interface{}) (string, bool) {
 func retrieveItemInSlice(value []interface{}) []interface{} {
 	for i, v := range value {
 		switch v.(type) {
-		case yaml.MapSlice:
-			value[i] = retrieveItems("", v.(yaml.MapSlice))
-		case string:
-			value[i] = ExpandValueEnv(v.(string))
+		case map[interface{}]interface{}:
+			value[i] = retrieveItems("", v.(map[interface{}]interface{}), false)
 		default:
 			//do nothing
 		}
@@ -95,6 +178,105 @@ func retrieveItemInSlice(value []interface{}) []interface{} {
 	return value
 }
 
+// retrieveMapItems flattens a decoded map into dotted keys like retrieveItems does,
+// it is shared by handlers which decode content into map[string]interface{}
+func retrieveMapItems(prefix string, subItems map[string]interface{}) map[string]interface{} {
+	if prefix != "" {
+		prefix += "."
+	}
+
+	result := map[string]interface{}{}
+
+	for k, v := range subItems {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for subKey, subValue := range retrieveMapItems(prefix+k, v) {
+				result[subKey] = subValue
+			}
+		case []map[string]interface{}:
+			items := make([]interface{}, 0, len(v))
+			for _, item := range v {
+				items = append(items, retrieveMapItems("", item))
+			}
+			result[prefix+k] = items
+		case []interface{}:
+			result[prefix+k] = retrieveMapItemInSlice(v)
+		default:
+			result[prefix+k] = normalizeValue(v)
+		}
+	}
+
+	return result
+}
+
+func retrieveMapItemInSlice(value []interface{}) []interface{} {
+	for i, v := range value {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			value[i] = retrieveMapItems("", v)
+		case []interface{}:
+			value[i] = retrieveMapItemInSlice(v)
+		default:
+			value[i] = normalizeValue(v)
+		}
+	}
+	return value
+}
+
+// normalizeValue makes scalar values the same types as yaml handler gives
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int64:
+		if int64(int(v)) == v {
+			return int(v)
+		}
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return normalizeValue(i)
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// expandItems expands environment variable placeholders of string values, including the ones in lists,
+// the error of a required variable tells the key
+func expandItems(items map[string]interface{}) error {
+	for k, v := range items {
+		expanded, err := expandItem(v)
+		if err != nil {
+			return fmt.Errorf("key [%s]: %s", k, err)
+		}
+		items[k] = expanded
+	}
+	return nil
+}
+
+func expandItem(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return ExpandEnv(strings.TrimSpace(v))
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := expandItem(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	case map[string]interface{}:
+		if err := expandItems(v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
 //UseFileNameAsKeyContentAsValue is a FileHandler, it sets the yaml file name as key and the content as value
 func UseFileNameAsKeyContentAsValue(p string, content []byte) (map[string]interface{}, error) {
 	_, filename := filepath.Split(p)
@@ -107,3 +289,19 @@ func UseFileNameAsKeyContentAsValue(p string, content []byte) (map[string]interf
 func Convert2configMap(p string, content []byte) (map[string]interface{}, error) {
 	return UseFileNameAsKeyContentAsValue(p, content)
 }
+
+var errorLine = regexp.MustCompile(`(?i)\bline (\d+)`)
+
+//ErrorLine returns the line number mentioned by an error of FileHandler, like "yaml: line 3: ...",
+//it returns 0 if there is none
+func ErrorLine(err error) int {
+	if err == nil {
+		return 0
+	}
+	m := errorLine.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
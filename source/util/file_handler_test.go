@@ -1,7 +1,9 @@
 package util
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,6 +35,46 @@ e:
 	assert.Equal(t, "none", v[1])
 }
 
+func TestConvert2JavaPropsYAMLFeatures(t *testing.T) {
+	b := []byte(`
+base: &base
+  host: localhost
+  port: 80
+svc:
+  <<: *base
+  port: 8080
+servers:
+  - host: a
+    port: 1
+  - *base
+tags: [x, y]
+---
+svc:
+  name: svc
+tags: [z]
+`)
+	t.Run("anchors and documents", func(t *testing.T) {
+		m, err := Convert2JavaProps("test.yaml", b)
+		assert.NoError(t, err)
+		assert.Equal(t, "localhost", m["svc.host"])
+		assert.Equal(t, 8080, m["svc.port"])
+		assert.Equal(t, "svc", m["svc.name"])
+		assert.Equal(t, []interface{}{"z"}, m["tags"])
+		servers := m["servers"].([]interface{})
+		assert.Equal(t, map[string]interface{}{"host": "localhost", "port": 80}, servers[1])
+		assert.NotContains(t, m, "servers[0].host")
+	})
+	t.Run("indexed keys", func(t *testing.T) {
+		m, err := Convert2JavaPropsWithIndexedKeys("test.yaml", b)
+		assert.NoError(t, err)
+		assert.Equal(t, "a", m["servers[0].host"])
+		assert.Equal(t, 80, m["servers[1].port"])
+		assert.Equal(t, "z", m["tags[0]"])
+		assert.NotContains(t, m, "tags[1]")
+		assert.Len(t, m["servers"], 2)
+	})
+}
+
 func TestConvert2ConfigMap(t *testing.T) {
 	b := []byte(`
 a: 1
@@ -44,3 +86,240 @@ c:
 	assert.NoError(t, err)
 	assert.Equal(t, b, m["test.yaml"])
 }
+
+func TestConvert2JSONProps(t *testing.T) {
+	b := []byte(`{
+  "a": 1,
+  "b": 1.5,
+  "c": {"d": "${NAME||10}", "e": true},
+  "f": [{"addr": "addvalue"}, "${TEST||none}"]
+}`)
+	os.Setenv("NAME", "go-archaius")
+	m, err := Convert2JSONProps("test.json", b)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m["a"])
+	assert.Equal(t, 1.5, m["b"])
+	assert.Equal(t, "go-archaius", m["c.d"])
+	assert.Equal(t, true, m["c.e"])
+	v, ok := m["f"].([]interface{})
+	if assert.True(t, ok) {
+		assert.Equal(t, map[string]interface{}{"addr": "addvalue"}, v[0])
+		assert.Equal(t, "none", v[1])
+	}
+
+	_, err = Convert2JSONProps("test.json", []byte(`{"a":`))
+	assert.Error(t, err)
+}
+
+func TestConvert2TOMLProps(t *testing.T) {
+	b := []byte(`
+a = 1
+[c]
+d = "${NAME||10}"
+[c.e]
+f = 1.5
+[[servers]]
+addr = "addvalue"
+`)
+	os.Setenv("NAME", "go-archaius")
+	m, err := Convert2TOMLProps("test.toml", b)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m["a"])
+	assert.Equal(t, "go-archaius", m["c.d"])
+	assert.Equal(t, 1.5, m["c.e.f"])
+	v, ok := m["servers"].([]interface{})
+	if assert.True(t, ok) {
+		assert.Equal(t, map[string]interface{}{"addr": "addvalue"}, v[0])
+	}
+
+	_, err = Convert2TOMLProps("test.toml", []byte(`a = `))
+	assert.Error(t, err)
+}
+
+func TestGetFileHandler(t *testing.T) {
+	m, err := GetFileHandler("/etc/app.JSON")("/etc/app.JSON", []byte(`{"a": {"b": 1}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m["a.b"])
+
+	m, err = GetFileHandler("app.conf")("app.conf", []byte("a:\n  b: 1\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m["a.b"])
+
+	RegisterFileHandler("conf", UseFileNameAsKeyContentAsValue)
+	m, err = GetFileHandler("app.conf")("app.conf", []byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), m["app.conf"])
+}
+
+func TestConvert2PropertiesProps(t *testing.T) {
+	b := []byte(`# comment
+! another comment
+a.b = 1
+c.d:${NAME||10}
+e.f   value with spaces
+multi = first, \
+        second
+key\ with\ space = \u4f60\u597d\tend
+emoji = \uD83D\uDE00
+path = C:\\dir
+empty
+padded = \ \ x\ 
+trailing = x  	
+`)
+	os.Setenv("NAME", "go-archaius")
+	m, err := Convert2PropertiesProps("test.properties", b)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", m["a.b"])
+	assert.Equal(t, "go-archaius", m["c.d"])
+	assert.Equal(t, "value with spaces", m["e.f"])
+	assert.Equal(t, "first, second", m["multi"])
+	assert.Equal(t, "你好\tend", m["key with space"])
+	assert.Equal(t, "😀", m["emoji"])
+	assert.Equal(t, `C:\dir`, m["path"])
+	assert.Equal(t, "", m["empty"])
+	assert.Equal(t, "  x ", m["padded"])
+	assert.Equal(t, "x", m["trailing"])
+
+	_, err = Convert2PropertiesProps("test.properties", []byte(`a = \u12`))
+	assert.Error(t, err)
+}
+
+func TestConvert2INIProps(t *testing.T) {
+	b := []byte(`; comment
+name = top
+[server]
+port = 8080
+addr: "${NAME||10}"
+[server.tls]
+# comment
+enabled = true
+padded = "  x  "
+`)
+	os.Setenv("NAME", "go-archaius")
+	m, err := Convert2INIProps("test.ini", b)
+	assert.NoError(t, err)
+	assert.Equal(t, "top", m["name"])
+	assert.Equal(t, "8080", m["server.port"])
+	assert.Equal(t, "go-archaius", m["server.addr"])
+	assert.Equal(t, "true", m["server.tls.enabled"])
+	assert.Equal(t, "  x  ", m["server.tls.padded"])
+
+	_, err = Convert2INIProps("test.ini", []byte("[server"))
+	assert.Error(t, err)
+}
+
+func TestConvert2DotEnvProps(t *testing.T) {
+	b := []byte(`# comment
+export DB_HOST=localhost
+DB_PORT = 5432 # inline comment
+DB_URL="postgres://${DB_HOST}:${DB_PORT}/app"
+RAW='${DB_HOST} stays'
+MULTI="line1
+line2\tend \${DB_HOST}"
+HOME_DIR=${DOTENV_HOME:-/home/app}
+NAME=${NAME}
+`)
+	os.Setenv("NAME", "go-archaius")
+	m, err := GetFileHandler("/app/.env")("/app/.env", b)
+	assert.NoError(t, err)
+	assert.NotContains(t, m, "DB_HOST")
+	assert.Equal(t, "localhost", m["DB.HOST"])
+	assert.Equal(t, "5432", m["DB.PORT"])
+	assert.Equal(t, "postgres://localhost:5432/app", m["DB.URL"])
+	assert.Equal(t, "${DB_HOST} stays", m["RAW"])
+	assert.Equal(t, "line1\nline2\tend ${DB_HOST}", m["MULTI"])
+	assert.Equal(t, "/home/app", m["HOME.DIR"])
+	assert.Equal(t, "go-archaius", m["NAME"])
+
+	_, err = Convert2DotEnvProps(".env", []byte(`A="unclosed`))
+	assert.Error(t, err)
+	_, err = Convert2DotEnvProps(".env", []byte(`A`))
+	assert.Error(t, err)
+	_, err = Convert2DotEnvProps(".env", []byte("A=1\nB=${DOTENV_MISSING:?must be set}\n"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "line 2")
+	}
+}
+
+func TestErrorLine(t *testing.T) {
+	_, err := Convert2JavaProps("a.yaml", []byte("a: 1\nb: [1\n"))
+	assert.Equal(t, 2, ErrorLine(err))
+	_, err = Convert2JSONProps("a.json", []byte("{\n\"a\": 1,\n\"b\" 2\n}"))
+	assert.Equal(t, 3, ErrorLine(err))
+	_, err = Convert2TOMLProps("a.toml", []byte("a = 1\nb = \n"))
+	assert.Equal(t, 2, ErrorLine(err))
+	_, err = Convert2DotEnvProps(".env", []byte("A=1\nB\n"))
+	assert.Equal(t, 2, ErrorLine(err))
+	assert.Equal(t, 0, ErrorLine(nil))
+}
+
+func TestConvert2JavaPropsErrorHidesContent(t *testing.T) {
+	_, err := Convert2JavaProps("a.yaml", []byte("password: s3cret\nb: [1\n"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "a.yaml")
+	assert.NotContains(t, err.Error(), "s3cret")
+	_, err = Convert2JavaProps("b.yaml", []byte("- s3cret\n"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "b.yaml")
+	assert.NotContains(t, err.Error(), "s3cret")
+}
+
+func TestConvert2JavaPropsImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imports")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		f := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(f), 0700))
+		assert.NoError(t, ioutil.WriteFile(f, []byte(content), 0600))
+		return f
+	}
+	a := write("common/a.yaml", "timeout: 1\nretry: 1\n")
+	b := write("common/b.yaml", "retry: 2\n")
+	db := write("db.yaml", "host: localhost\nport: 5432\n")
+	app := write("app.yaml", `archaius:
+  imports:
+    - common/*.yaml
+name: app
+timeout: 3
+db: !include db.yaml
+`)
+	content, _ := ioutil.ReadFile(app)
+	m, err := Convert2JavaProps(app, content)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":    "app",
+		"timeout": 3,
+		"retry":   2,
+		"db.host": "localhost",
+		"db.port": 5432,
+	}, m)
+	assert.Equal(t, []string{a, b, db}, ImportedFiles(app))
+
+	t.Run("cycle", func(t *testing.T) {
+		write("x.yaml", "archaius.imports: [y.yaml]\n")
+		y := write("y.yaml", "archaius:\n  imports: [x.yaml]\n")
+		content, _ := ioutil.ReadFile(y)
+		_, err := Convert2JavaProps(y, content)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "import cycle")
+		}
+	})
+	t.Run("missing file", func(t *testing.T) {
+		_, err := Convert2JavaProps(app, []byte("db: !include missing.yaml\n"))
+		assert.Error(t, err)
+		assert.Equal(t, []string{filepath.Join(dir, "missing.yaml")}, ImportedFiles(app))
+	})
+}
+
+func TestConvert2JavaPropsImportsKey(t *testing.T) {
+	m, err := Convert2JavaProps("app.yaml", []byte("imports:\n  enabled: true\nexports: [a.yaml]\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"imports.enabled": true, "exports": []interface{}{"a.yaml"}}, m)
+	m, err = Convert2JavaProps("app.yaml", []byte("imports: [a.yaml]\n# !include b.yaml\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"imports": []interface{}{"a.yaml"}}, m)
+	assert.Empty(t, ImportedFiles("app.yaml"))
+	_, err = Convert2JavaProps("app.yaml", []byte("archaius:\n  imports:\n    enabled: true\n"))
+	assert.Error(t, err)
+}
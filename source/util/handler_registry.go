@@ -0,0 +1,48 @@
+package util
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	handlerMux sync.RWMutex
+	// handlers maps file extension to the FileHandler which converts this kind of file
+	handlers map[string]FileHandler
+)
+
+// handlers are set in init, because yaml handler uses them to convert imported files
+func init() {
+	handlers = map[string]FileHandler{
+		".yaml":       Convert2JavaProps,
+		".yml":        Convert2JavaProps,
+		".json":       Convert2JSONProps,
+		".toml":       Convert2TOMLProps,
+		".properties": Convert2PropertiesProps,
+		".ini":        Convert2INIProps,
+		".env":        Convert2DotEnvProps,
+	}
+}
+
+// RegisterFileHandler registers handler for file extension, like ".json",
+// file sources use it for files added without a handler. extension is case insensitive
+func RegisterFileHandler(ext string, handler FileHandler) {
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	handlerMux.Lock()
+	defer handlerMux.Unlock()
+	handlers[strings.ToLower(ext)] = handler
+}
+
+// GetFileHandler returns the handler registered for extension of file,
+// if there is none, it returns Convert2JavaProps which handles yaml
+func GetFileHandler(filePath string) FileHandler {
+	handlerMux.RLock()
+	defer handlerMux.RUnlock()
+	if h, ok := handlers[strings.ToLower(filepath.Ext(filePath))]; ok && h != nil {
+		return h
+	}
+	return Convert2JavaProps
+}
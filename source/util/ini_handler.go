@@ -0,0 +1,51 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Convert2INIProps is a FileHandler
+// it converts ini content into key values, "key=value" under "[section]" becomes "section.key",
+// keys before the first section have no prefix. lines start with ";" or "#" are comments
+func Convert2INIProps(p string, content []byte) (map[string]interface{}, error) {
+	configMap := make(map[string]interface{})
+	section := ""
+	for i, line := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("ini [%s] line %d: unclosed section [%s]", p, i+1, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value := line, ""
+		if idx := strings.IndexAny(line, "=:"); idx >= 0 {
+			key, value = strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:])
+		}
+		if key == "" {
+			return nil, fmt.Errorf("ini [%s] line %d: empty key", p, i+1)
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		expanded, err := ExpandEnv(unquote(value))
+		if err != nil {
+			return nil, fmt.Errorf("ini [%s] line %d: %s", p, i+1, err)
+		}
+		configMap[key] = expanded
+	}
+	return configMap, nil
+}
+
+// unquote removes a pair of quotes around value
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
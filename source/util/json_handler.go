@@ -0,0 +1,31 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Convert2JSONProps is a FileHandler
+// it converts the json content into java props, nested objects are flattened into dotted keys
+func Convert2JSONProps(p string, content []byte) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if len(bytes.TrimSpace(content)) == 0 {
+		return m, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	// keep integers as integers like yaml does, instead of float64
+	decoder.UseNumber()
+	if err := decoder.Decode(&m); err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			line := bytes.Count(content[:se.Offset], []byte("\n")) + 1
+			return nil, fmt.Errorf("json unmarshal [%s] failed at line %d, %s", p, line, err)
+		}
+		return nil, fmt.Errorf("json unmarshal [%s] failed, %s", p, err)
+	}
+	items := retrieveMapItems("", m)
+	if err := expandItems(items); err != nil {
+		return nil, fmt.Errorf("json [%s]: %s", p, err)
+	}
+	return items, nil
+}
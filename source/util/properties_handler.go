@@ -0,0 +1,149 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Convert2PropertiesProps is a FileHandler
+// it converts java .properties content into key values, it follows java.util.Properties semantics:
+// "#" and "!" comments, "=", ":" or white space separators, line continuations and escapes like \uXXXX.
+// white space around value is dropped unless it is escaped, like "key=\ \ value\ "
+func Convert2PropertiesProps(p string, content []byte) (map[string]interface{}, error) {
+	configMap := make(map[string]interface{})
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		lineNum := i + 1
+		// join the natural lines of a logical line, leading white space of continuation lines is dropped
+		for continued(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+		if continued(line) {
+			line = line[:len(line)-1]
+		}
+		key, value := splitProperty(line)
+		value = trimUnescapedRight(value)
+		k, err := unescapeProperty(key)
+		if err != nil {
+			return nil, fmt.Errorf("properties [%s] line %d: %s", p, lineNum, err)
+		}
+		v, err := unescapeProperty(value)
+		if err != nil {
+			return nil, fmt.Errorf("properties [%s] line %d: %s", p, lineNum, err)
+		}
+		if configMap[k], err = ExpandEnv(v); err != nil {
+			return nil, fmt.Errorf("properties [%s] line %d: %s", p, lineNum, err)
+		}
+	}
+	return configMap, nil
+}
+
+// continued reports whether line ends with an odd number of backslashes
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitProperty splits a logical line into escaped key and value
+func splitProperty(line string) (string, string) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == '=' || line[i] == ':' || line[i] == ' ' || line[i] == '\t' || line[i] == '\f' {
+			end = i
+			break
+		}
+	}
+	key := line[:end]
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return key, rest
+}
+
+// trimUnescapedRight drops the trailing white space of s which is not escaped
+func trimUnescapedRight(s string) string {
+	for len(s) > 0 {
+		c := s[len(s)-1]
+		if c != ' ' && c != '\t' && c != '\f' {
+			break
+		}
+		if continued(s[:len(s)-1]) {
+			// escaped by the backslash before it
+			break
+		}
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			r, err := parseUnicode(s, i+1)
+			if err != nil {
+				return "", err
+			}
+			i += 4
+			// a surrogate pair is written as two escapes, like \uD83D\uDE00
+			if utf16.IsSurrogate(r) && i+2 < len(s) && s[i+1] == '\\' && s[i+2] == 'u' {
+				if r2, err := parseUnicode(s, i+3); err == nil {
+					if pair := utf16.DecodeRune(r, r2); pair != unicode.ReplacementChar {
+						r = pair
+						i += 6
+					}
+				}
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// parseUnicode parses the 4 hex digits of \uxxxx escape from start
+func parseUnicode(s string, start int) (rune, error) {
+	if start+4 > len(s) {
+		return 0, fmt.Errorf("malformed \\uxxxx encoding in [%s]", s)
+	}
+	r, err := strconv.ParseUint(s[start:start+4], 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("malformed \\uxxxx encoding in [%s]", s)
+	}
+	return rune(r), nil
+}
@@ -0,0 +1,21 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Convert2TOMLProps is a FileHandler
+// it converts the toml content into java props, tables are flattened into dotted keys
+func Convert2TOMLProps(p string, content []byte) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if _, err := toml.Decode(string(content), &m); err != nil {
+		return nil, fmt.Errorf("toml unmarshal [%s] failed, %s", p, err)
+	}
+	items := retrieveMapItems("", m)
+	if err := expandItems(items); err != nil {
+		return nil, fmt.Errorf("toml [%s]: %s", p, err)
+	}
+	return items, nil
+}
@@ -0,0 +1,277 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// importsKey is the reserved top level key which lists the files merged into a yaml file,
+	// keys of the yaml file override the imported ones, and a later import overrides an earlier one.
+	// it can be written as "archaius.imports" or as "imports" under "archaius"
+	importsKey = "archaius.imports"
+	// includeTag makes the value of a key the content of another file, like "db: !include db.yaml"
+	includeTag = "!include"
+)
+
+var (
+	importsMux sync.RWMutex
+	// importedFiles maps a yaml file to the files it imports or includes, directly or not
+	importedFiles = make(map[string][]string)
+)
+
+//ImportedFiles returns the files imported or included by a yaml file when it was converted last time,
+//a change of them should convert the yaml file again
+func ImportedFiles(filePath string) []string {
+	importsMux.RLock()
+	defer importsMux.RUnlock()
+	files := importedFiles[filePath]
+	result := make([]string, len(files))
+	copy(result, files)
+	return result
+}
+
+//ForgetImports drops the files recorded for a yaml file, it should be called when the yaml file is no longer used
+func ForgetImports(filePath string) {
+	importsMux.Lock()
+	delete(importedFiles, filePath)
+	importsMux.Unlock()
+}
+
+// hasImports reports whether a document of content has the imports key or a value tagged by !include,
+// content which is not valid yaml has none, converting it reports the error
+func hasImports(content []byte) bool {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		doc := new(yaml.Node)
+		if err := decoder.Decode(doc); err != nil {
+			return false
+		}
+		if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+			if parent, _, _ := findImports(doc.Content[0]); parent != nil {
+				return true
+			}
+		}
+		if hasIncludeTag(doc) {
+			return true
+		}
+	}
+}
+
+func hasIncludeTag(node *yaml.Node) bool {
+	if node.Tag == includeTag {
+		return true
+	}
+	for _, n := range node.Content {
+		if hasIncludeTag(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// findImports returns the mapping which has the imports key and the index of the key in it,
+// if the mapping is "archaius" under root, it also returns the index of "archaius" in root
+func findImports(root *yaml.Node) (*yaml.Node, int, int) {
+	prefix := strings.SplitN(importsKey, ".", 2)
+	for j := 0; j+1 < len(root.Content); j += 2 {
+		switch {
+		case root.Content[j].Value == importsKey:
+			return root, j, -1
+		case root.Content[j].Value == prefix[0] && root.Content[j+1].Kind == yaml.MappingNode:
+			m := root.Content[j+1]
+			for i := 0; i+1 < len(m.Content); i += 2 {
+				if m.Content[i].Value == prefix[1] {
+					return m, i, j
+				}
+			}
+		}
+	}
+	return nil, 0, 0
+}
+
+// yamlImporter resolves imports and includes of a yaml file
+type yamlImporter struct {
+	// stack is the chain of files being resolved, to detect cycles
+	stack []string
+	// files are all the files imported or included
+	files map[string]bool
+	// indexed gives a key to each item of sequences
+	indexed bool
+}
+
+// convertWithImports converts yaml content like Convert2JavaProps does, and merges the imported and included files
+func convertWithImports(p string, content []byte, indexed bool) (map[string]interface{}, error) {
+	im := &yamlImporter{files: make(map[string]bool), indexed: indexed}
+	configMap, err := im.resolve(p, content)
+	files := make([]string, 0, len(im.files))
+	for f := range im.files {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	importsMux.Lock()
+	importedFiles[p] = files
+	importsMux.Unlock()
+	return configMap, err
+}
+
+func (im *yamlImporter) resolve(p string, content []byte) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range im.stack {
+		if f == abs {
+			return nil, fmt.Errorf("import cycle: %s -> %s", strings.Join(im.stack, " -> "), abs)
+		}
+	}
+	im.stack = append(im.stack, abs)
+	defer func() { im.stack = im.stack[:len(im.stack)-1] }()
+
+	docs := make([]*yaml.Node, 0)
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		doc := new(yaml.Node)
+		err := decoder.Decode(doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("yaml unmarshal [%s] failed, %s", p, err)
+		}
+		docs = append(docs, doc)
+	}
+	dir := filepath.Dir(abs)
+
+	// imports and includes of all documents are resolved, then the documents are converted in order
+	result := make(map[string]interface{})
+	imports := make([]string, 0)
+	included := make(map[string]map[string]interface{})
+	buf := bytes.NewBuffer(nil)
+	encoder := yaml.NewEncoder(buf)
+	for _, doc := range docs {
+		if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+			files, err := im.takeImports(doc.Content[0], dir)
+			if err != nil {
+				return nil, fmt.Errorf("imports of [%s]: %s", p, err)
+			}
+			imports = append(imports, files...)
+			if err := im.takeIncludes(doc.Content[0], "", dir, included); err != nil {
+				return nil, fmt.Errorf("includes of [%s]: %s", p, err)
+			}
+		}
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	for _, f := range imports {
+		configMap, err := im.load(f)
+		if err != nil {
+			return nil, err
+		}
+		mergeItems(result, configMap)
+	}
+
+	own, err := convertYAML(p, buf.Bytes(), im.indexed)
+	if err != nil {
+		return nil, err
+	}
+	mergeItems(result, own)
+	for prefix, configMap := range included {
+		for k, v := range configMap {
+			result[prefix+"."+k] = v
+		}
+	}
+	return result, nil
+}
+
+// takeImports removes the imports key from root and returns the files it lists, globs are expanded
+func (im *yamlImporter) takeImports(root *yaml.Node, dir string) ([]string, error) {
+	parent, i, j := findImports(root)
+	if parent == nil {
+		return nil, nil
+	}
+	var list []string
+	if parent.Content[i+1].Kind != yaml.SequenceNode || parent.Content[i+1].Decode(&list) != nil {
+		return nil, fmt.Errorf("%s must be a list of files", importsKey)
+	}
+	parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+	if parent != root && len(parent.Content) == 0 {
+		root.Content = append(root.Content[:j], root.Content[j+2:]...)
+	}
+	files := make([]string, 0, len(list))
+	for _, f := range list {
+		f = relativeTo(dir, f)
+		if !strings.ContainsAny(f, "*?[") {
+			files = append(files, f)
+			continue
+		}
+		matches, err := filepath.Glob(f)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// takeIncludes replaces the values tagged by !include with empty maps,
+// and converts the included files into included by the dotted key of each value
+func (im *yamlImporter) takeIncludes(node *yaml.Node, prefix, dir string, included map[string]map[string]interface{}) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		value := node.Content[i+1]
+		if value.Tag != includeTag {
+			if err := im.takeIncludes(value, key, dir, included); err != nil {
+				return err
+			}
+			continue
+		}
+		configMap, err := im.load(relativeTo(dir, value.Value))
+		if err != nil {
+			return err
+		}
+		included[key] = configMap
+		*value = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	return nil
+}
+
+// load converts an imported or included file, yaml files are resolved recursively
+func (im *yamlImporter) load(f string) (map[string]interface{}, error) {
+	im.files[f] = true
+	content, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("read [%s] failed, %s", f, err)
+	}
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".yaml", ".yml":
+		return im.resolve(f, content)
+	default:
+		return GetFileHandler(f)(f, content)
+	}
+}
+
+func relativeTo(dir, f string) string {
+	if filepath.IsAbs(f) {
+		return filepath.Clean(f)
+	}
+	return filepath.Join(dir, f)
+}